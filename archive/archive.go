@@ -0,0 +1,195 @@
+// Package archive stores ticket folders as tar.zst archives and keeps an index of them.
+package archive
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Extension of the archives
+const Extension = ".tar.zst"
+
+// ExcludeFunc tells if a file or folder of the archived folder should be left out,
+// rel is the slash separated path relative to the archived folder
+type ExcludeFunc func(rel string, d fs.DirEntry) bool
+
+// Create compresses folder into the archive file at dest and returns its size
+func Create(folder, dest string, exclude ExcludeFunc) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create archive dir: %w", err)
+	}
+
+	tmp := dest + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer os.Remove(tmp)
+	defer f.Close()
+
+	zw, err := zstd.NewWriter(f)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create zstd writer: %w", err)
+	}
+	tw := tar.NewWriter(zw)
+
+	err = filepath.WalkDir(folder, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(folder, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		if exclude != nil && exclude(rel, d) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		return addToTar(tw, path, rel, d)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to archive %s: %w", folder, err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return 0, fmt.Errorf("failed to finish tar: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return 0, fmt.Errorf("failed to finish compression: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return 0, fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	if err := os.Rename(tmp, dest); err != nil {
+		return 0, fmt.Errorf("failed to move archive in place: %w", err)
+	}
+
+	info, err := os.Stat(dest)
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
+
+func addToTar(tw *tar.Writer, path, rel string, d fs.DirEntry) error {
+	info, err := d.Info()
+	if err != nil {
+		return err
+	}
+
+	link := ""
+	if info.Mode()&os.ModeSymlink != 0 {
+		if link, err = os.Readlink(path); err != nil {
+			return err
+		}
+	}
+
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	header.Name = rel
+	if d.IsDir() {
+		header.Name += "/"
+	}
+
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// Extract unpacks the archive file into dest
+func Extract(archivePath, dest string) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	zr, err := zstd.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("failed to create zstd reader: %w", err)
+	}
+	defer zr.Close()
+
+	tr := tar.NewReader(zr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		path := filepath.Join(dest, filepath.FromSlash(header.Name))
+		if !strings.HasPrefix(path, filepath.Clean(dest)+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid path in archive: %s", header.Name)
+		}
+
+		if err := extractEntry(tr, header, path); err != nil {
+			return fmt.Errorf("failed to extract %s: %w", header.Name, err)
+		}
+	}
+}
+
+func extractEntry(tr *tar.Reader, header *tar.Header, path string) error {
+	switch header.Typeflag {
+	case tar.TypeDir:
+		return os.MkdirAll(path, 0755)
+	case tar.TypeSymlink:
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		return os.Symlink(header.Linkname, path)
+	case tar.TypeReg:
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+
+		out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, header.FileInfo().Mode().Perm())
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		if _, err := io.Copy(out, tr); err != nil {
+			return err
+		}
+		return out.Close()
+	default:
+		// nothing else is expected in a ticket folder
+		return nil
+	}
+}
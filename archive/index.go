@@ -0,0 +1,88 @@
+package archive
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const indexFileName = "index.json"
+
+// Entry describes an archived ticket folder
+type Entry struct {
+	TicketID int64     `json:"ticket_id"`
+	File     string    `json:"file"`
+	Size     int64     `json:"size"`
+	Reason   string    `json:"reason,omitempty"`
+	Excluded []string  `json:"excluded,omitempty"`
+	Archived time.Time `json:"archived_at"`
+}
+
+// Index lists the archives of an archive dir
+type Index struct {
+	Entries []Entry `json:"entries"`
+}
+
+// LoadIndex reads the index of the archive dir, a missing index is an empty one
+func LoadIndex(dir string) (*Index, error) {
+	idx := &Index{}
+	b, err := os.ReadFile(filepath.Join(dir, indexFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive index: %w", err)
+	}
+
+	if err := json.Unmarshal(b, idx); err != nil {
+		return nil, fmt.Errorf("failed to decode archive index: %w", err)
+	}
+
+	return idx, nil
+}
+
+// Save writes the index in the archive dir
+func (idx *Index) Save(dir string) error {
+	b, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode archive index: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create archive dir: %w", err)
+	}
+
+	path := filepath.Join(dir, indexFileName)
+	if err := os.WriteFile(path+".tmp", b, 0644); err != nil {
+		return fmt.Errorf("failed to write archive index: %w", err)
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+// Add records a new archive
+func (idx *Index) Add(e Entry) {
+	idx.Entries = append(idx.Entries, e)
+}
+
+// Latest returns the most recent archive of a ticket
+func (idx *Index) Latest(ticketID int64) (Entry, bool) {
+	var latest Entry
+	found := false
+	for _, e := range idx.Entries {
+		if e.TicketID == ticketID && (!found || e.Archived.After(latest.Archived)) {
+			latest = e
+			found = true
+		}
+	}
+
+	return latest, found
+}
+
+// FileName returns the name of a new archive for the ticket
+func FileName(ticketID int64, at time.Time) string {
+	return fmt.Sprintf("ZD-%d-%s%s", ticketID, at.UTC().Format("20060102T150405Z"), Extension)
+}
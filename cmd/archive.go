@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julientant/supportctl/archive"
+	"github.com/julientant/supportctl/ticketprep"
+	"github.com/spf13/viper"
+)
+
+// archiveDir returns the folder holding the archived ticket folders
+func archiveDir() string {
+	if dir := viper.GetString("archive-dir"); dir != "" {
+		return dir
+	}
+
+	return filepath.Join(viper.GetString("work-dir"), ".archive")
+}
+
+// archiveTicketFolder compresses the ticket folder in the archive dir and records it in the index,
+// the caller holds the index and ticket locks
+func archiveTicketFolder(id int64, reason string) error {
+	dir := archiveDir()
+	idx, err := archive.LoadIndex(dir)
+	if err != nil {
+		return err
+	}
+
+	var exclude archive.ExcludeFunc
+	excluded := []string{}
+	if viper.GetBool("prune.archive-exclude-packets") {
+		exclude = func(rel string, d fs.DirEntry) bool {
+			if rel == ticketprep.SupportPacketDir || (!strings.Contains(rel, "/") && ticketprep.SupportPacketRegex.MatchString(rel)) {
+				excluded = append(excluded, rel)
+				return true
+			}
+			return false
+		}
+	}
+
+	now := time.Now()
+	file := archive.FileName(id, now)
+	size, err := archive.Create(getTicketFolderPath(strconv.FormatInt(id, 10)), filepath.Join(dir, file), exclude)
+	if err != nil {
+		return err
+	}
+
+	idx.Add(archive.Entry{
+		TicketID: id,
+		File:     file,
+		Size:     size,
+		Reason:   reason,
+		Excluded: excluded,
+		Archived: now,
+	})
+	if err := idx.Save(dir); err != nil {
+		return fmt.Errorf("failed to save archive index: %w", err)
+	}
+
+	return nil
+}
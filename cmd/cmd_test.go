@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	gitlib "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/julientant/supportctl/zendesk"
+	"github.com/julientant/supportctl/zendesk/zendesktest"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const testDockerCompose = `services:
+  mattermost:
+    container_name: cs-repro-mattermost
+    image: mattermost/mattermost-enterprise-edition:latest
+`
+
+// setupTest starts a fake zendesk with the fixtures loaded, points the commands to it
+// and isolates them in temporary work, home and cache folders.
+func setupTest(t *testing.T) (*zendesktest.Server, string) {
+	t.Helper()
+
+	server := zendesktest.NewServer(t)
+	server.LoadFixtures()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(home, ".cache"))
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("XDG_STATE_HOME", filepath.Join(home, ".local", "state"))
+
+	previous := newZendeskClient
+	newZendeskClient = func() (zendesk.API, error) {
+		client, err := zendesk.NewClientFromViper(viper.GetViper())
+		if err != nil {
+			return nil, err
+		}
+
+		return client, client.SetEndpointURL(server.EndpointURL())
+	}
+	t.Cleanup(func() {
+		newZendeskClient = previous
+	})
+
+	workDir := filepath.Join(t.TempDir(), "work")
+	resetViper()
+	viper.Set("work-dir", workDir)
+	viper.Set("zendesk.subdomain", "zendesktest")
+	viper.Set("zendesk.bearer-token", zendesktest.Token)
+	t.Cleanup(resetViper)
+
+	return server, workDir
+}
+
+// resetViper drops the settings and flags of the previous test and binds the flags again,
+// every setting is bound to the flag of the same name.
+func resetViper() {
+	viper.Reset()
+	resetFlags()
+
+	visitFlags(func(f *pflag.Flag) {
+		if f.Name != "config" && f.Name != "help" {
+			viper.BindPFlag(f.Name, f)
+		}
+	})
+}
+
+// resetFlags sets the flags of all the commands back to their defaults, so the flags given
+// to a command do not leak into the next one. It panics on a flag it cannot restore.
+func resetFlags() {
+	visitFlags(func(f *pflag.Flag) {
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			// setting a slice flag again appends to it, the default is restored as a whole
+			values := []string{}
+			if def := strings.Trim(f.DefValue, "[]"); def != "" {
+				values = strings.Split(def, ",")
+			}
+			slice.Replace(values)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+
+		if f.Value.String() != f.DefValue {
+			panic(fmt.Sprintf("flag %s is %s after reset instead of its default %s", f.Name, f.Value, f.DefValue))
+		}
+	})
+}
+
+// visitFlags calls fn with the flags of all the commands, the local and persistent ones
+func visitFlags(fn func(f *pflag.Flag)) {
+	var visit func(cmd *cobra.Command)
+	visit = func(cmd *cobra.Command) {
+		cmd.Flags().VisitAll(fn)
+		cmd.PersistentFlags().VisitAll(fn)
+
+		for _, sub := range cmd.Commands() {
+			visit(sub)
+		}
+	}
+	visit(rootCmd)
+}
+
+// runCommand executes supportctl with the given arguments
+func runCommand(ctx context.Context, t *testing.T, args ...string) error {
+	t.Helper()
+
+	if ctx == nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+	}
+
+	// cobra only hands the context to a command that does not have one yet
+	cmd, _, err := rootCmd.Find(args)
+	if err != nil {
+		t.Fatalf("unknown command %v: %s", args, err)
+	}
+	cmd.SetContext(ctx)
+
+	resetFlags()
+	rootCmd.SetArgs(args)
+	return rootCmd.ExecuteContext(ctx)
+}
+
+// makeCSReproRepo creates a local git repository standing in for CS-Repro-Mattermost
+func makeCSReproRepo(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	repo, err := gitlib.PlainInit(dir, false)
+	if err != nil {
+		t.Fatalf("failed to init repo: %s", err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "docker-compose.yml"), []byte(testDockerCompose), 0644)
+	if err != nil {
+		t.Fatalf("failed to write docker-compose.yml: %s", err)
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed to get worktree: %s", err)
+	}
+	if _, err := wt.Add("docker-compose.yml"); err != nil {
+		t.Fatalf("failed to add file: %s", err)
+	}
+	_, err = wt.Commit("initial commit", &gitlib.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatalf("failed to commit: %s", err)
+	}
+
+	return dir
+}
+
+func ticketFolder(workDir string, id int64) string {
+	return filepath.Join(workDir, "ZD-"+formatID(id))
+}
+
+func formatID(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
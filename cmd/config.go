@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// commands with this annotation can run with a profile that is not defined yet,
+// e.g. login creating a brand new profile
+const allowNewProfileAnnotation = "supportctl/allow-new-profile"
+
+// activeProfile returns the name of the profile selected by --profile,
+// SUPPORTCTL_PROFILE or the profile key of the config file
+func activeProfile() string {
+	return viper.GetString("profile")
+}
+
+// profileNames returns the sorted list of profiles defined in the config file
+func profileNames() []string {
+	names := []string{}
+	for name := range viper.GetStringMap("profiles") {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func profileExists(name string) bool {
+	_, ok := viper.GetStringMap("profiles")[name]
+	return ok
+}
+
+// profileKey returns the config key to use to persist the given setting,
+// scoped to the active profile if there is one
+func profileKey(key string) string {
+	if profile := activeProfile(); profile != "" {
+		return "profiles." + profile + "." + key
+	}
+
+	return key
+}
+
+// applyProfile overrides the top level settings with the ones of the active profile.
+// Settings explicitly passed as flags still take precedence.
+func applyProfile(cmd *cobra.Command, _ []string) error {
+	profile := activeProfile()
+	if profile == "" {
+		return nil
+	}
+
+	if !profileExists(profile) {
+		if _, ok := cmd.Annotations[allowNewProfileAnnotation]; !ok {
+			return fmt.Errorf("profile %q is not defined in the config file", profile)
+		}
+	}
+
+	hasWorkDir := false
+	if sub := viper.Sub("profiles." + profile); sub != nil {
+		for _, key := range sub.AllKeys() {
+			if key == "work-dir" {
+				hasWorkDir = true
+			}
+			if f := cmd.Flags().Lookup(key); f != nil && f.Changed {
+				continue
+			}
+			viper.Set(key, sub.Get(key))
+		}
+	}
+
+	// keep the tickets of each profile in their own folder unless told otherwise
+	if f := cmd.Flags().Lookup("work-dir"); !hasWorkDir && (f == nil || !f.Changed) {
+		viper.Set("work-dir", filepath.Join(viper.GetString("work-dir"), profile))
+	}
+
+	return nil
+}
+
+// configFilePath returns the config file in use, or the default one if none was found
+func configFilePath() (string, error) {
+	if f := viper.ConfigFileUsed(); f != "" {
+		if _, err := os.Stat(f); err == nil || cfgFile != "" {
+			return f, nil
+		}
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home dir: %w", err)
+	}
+
+	return filepath.Join(home, ".supportctl.yaml"), nil
+}
+
+// saveConfig persists the given values in the config file.
+// A fresh viper is used so runtime overrides (flags, active profile) are not written back.
+func saveConfig(values map[string]any) error {
+	path, err := configFilePath()
+	if err != nil {
+		return err
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	for key, value := range values {
+		v.Set(key, value)
+	}
+
+	if err := v.WriteConfigAs(path); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	return nil
+}
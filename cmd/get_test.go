@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/julientant/supportctl/manifest"
+	"github.com/julientant/supportctl/zendesk/zendesktest"
+	"github.com/spf13/viper"
+)
+
+func TestGet(t *testing.T) {
+	_, workDir := setupTest(t)
+	viper.Set("get.cs-repro-repo", makeCSReproRepo(t))
+
+	if err := runCommand(nil, t, "get", formatID(zendesktest.FixtureOpenTicketID)); err != nil {
+		t.Fatalf("get failed: %s", err)
+	}
+
+	folder := ticketFolder(workDir, zendesktest.FixtureOpenTicketID)
+
+	// only the latest support packet is downloaded
+	if _, err := os.Stat(filepath.Join(folder, "mattermost_support_packet_2023-10-01-10-00.zip")); err != nil {
+		t.Errorf("latest support packet was not downloaded: %s", err)
+	}
+	for _, name := range []string{"mattermost_support_packet_2023-09-01-10-00.zip", "mattermost.log"} {
+		if _, err := os.Stat(filepath.Join(folder, name)); err == nil {
+			t.Errorf("%s should not have been downloaded", name)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(folder, "latest-support-packet", "support_packet.yaml")); err != nil {
+		t.Errorf("support packet was not extracted: %s", err)
+	}
+
+	compose, err := os.ReadFile(filepath.Join(folder, "cs-repro", "docker-compose.yml"))
+	if err != nil {
+		t.Fatalf("failed to read docker-compose.yml: %s", err)
+	}
+	for _, expected := range []string{
+		"name: cs-repro-" + formatID(zendesktest.FixtureOpenTicketID),
+		"mattermost-enterprise-edition:" + zendesktest.FixtureServerVersion,
+		"cs-repro-" + formatID(zendesktest.FixtureOpenTicketID) + "-mattermost",
+	} {
+		if !strings.Contains(string(compose), expected) {
+			t.Errorf("docker-compose.yml does not contain %q:\n%s", expected, compose)
+		}
+	}
+}
+
+func TestGetAllAttachments(t *testing.T) {
+	_, workDir := setupTest(t)
+	viper.Set("get.cs-repro-repo", makeCSReproRepo(t))
+	viper.Set("get.all-attachments", true)
+
+	if err := runCommand(nil, t, "get", formatID(zendesktest.FixtureOpenTicketID)); err != nil {
+		t.Fatalf("get failed: %s", err)
+	}
+
+	folder := ticketFolder(workDir, zendesktest.FixtureOpenTicketID)
+	for _, name := range []string{
+		"mattermost_support_packet_2023-09-01-10-00.zip",
+		"mattermost_support_packet_2023-10-01-10-00.zip",
+		"mattermost.log",
+	} {
+		if _, err := os.Stat(filepath.Join(folder, name)); err != nil {
+			t.Errorf("%s was not downloaded: %s", name, err)
+		}
+	}
+}
+
+func TestGetUnknownTicket(t *testing.T) {
+	setupTest(t)
+
+	if err := runCommand(nil, t, "get", "999999"); err == nil {
+		t.Fatal("expected an error for an unknown ticket")
+	}
+}
+
+func TestGetRejectedToken(t *testing.T) {
+	setupTest(t)
+	viper.Set("zendesk.bearer-token", "revoked")
+
+	err := runCommand(nil, t, "get", formatID(zendesktest.FixtureOpenTicketID))
+	if err != errTokenRejected {
+		t.Fatalf("expected the token to be rejected, got %v", err)
+	}
+}
+
+func TestGetAPIToken(t *testing.T) {
+	_, workDir := setupTest(t)
+	viper.Set("get.cs-repro-repo", makeCSReproRepo(t))
+	viper.Set("zendesk.bearer-token", "")
+	viper.Set("zendesk.auth-mode", "api-token")
+	viper.Set("zendesk.email", zendesktest.Email)
+	viper.Set("zendesk.api-token", zendesktest.Token)
+
+	if err := runCommand(nil, t, "get", formatID(zendesktest.FixtureOpenTicketID)); err != nil {
+		t.Fatalf("get failed: %s", err)
+	}
+	if _, err := os.Stat(ticketFolder(workDir, zendesktest.FixtureOpenTicketID)); err != nil {
+		t.Errorf("ticket folder was not created: %s", err)
+	}
+
+	viper.Set("zendesk.api-token", "revoked")
+	err := runCommand(nil, t, "get", formatID(zendesktest.FixtureOpenTicketID))
+	if err != errTokenRejected {
+		t.Fatalf("expected the API token to be rejected, got %v", err)
+	}
+}
+
+func TestGetPrivateAttachments(t *testing.T) {
+	server, workDir := setupTest(t)
+	server.PrivateAttachments = true
+	viper.Set("get.cs-repro-repo", makeCSReproRepo(t))
+
+	if err := runCommand(nil, t, "get", formatID(zendesktest.FixtureOpenTicketID)); err != nil {
+		t.Fatalf("get failed: %s", err)
+	}
+
+	folder := ticketFolder(workDir, zendesktest.FixtureOpenTicketID)
+	if _, err := os.Stat(filepath.Join(folder, "latest-support-packet", "support_packet.yaml")); err != nil {
+		t.Errorf("support packet was not downloaded from the storage: %s", err)
+	}
+}
+
+func TestGetWritesManifest(t *testing.T) {
+	_, workDir := setupTest(t)
+	viper.Set("get.cs-repro-repo", makeCSReproRepo(t))
+
+	if err := runCommand(nil, t, "get", formatID(zendesktest.FixtureOpenTicketID)); err != nil {
+		t.Fatalf("get failed: %s", err)
+	}
+
+	folder := ticketFolder(workDir, zendesktest.FixtureOpenTicketID)
+	m, err := manifest.Load(folder)
+	if err != nil {
+		t.Fatalf("failed to load manifest: %s", err)
+	}
+
+	if m.Ticket.Subject != "Server crashes on startup" || m.Ticket.Status != "open" {
+		t.Errorf("unexpected ticket %+v", m.Ticket)
+	}
+	if m.Ticket.RequesterName != "Jane Customer" || m.Ticket.OrganizationName != "Acme Corp" {
+		t.Errorf("names were not resolved: %+v", m.Ticket)
+	}
+	if len(m.Attachments) != 1 || m.Attachments[0].SHA256 == "" || m.Attachments[0].Size == 0 {
+		t.Errorf("unexpected attachments %+v", m.Attachments)
+	}
+	if m.SupportPacket == nil || m.SupportPacket.ServerVersion != zendesktest.FixtureServerVersion {
+		t.Errorf("unexpected support packet %+v", m.SupportPacket)
+	}
+	if m.Repro == nil || len(m.Repro.Commit) != 40 {
+		t.Errorf("unexpected repro %+v", m.Repro)
+	}
+
+	// a second run refreshes the manifest but remembers when the folder was created
+	createdAt := m.CreatedAt
+	if err := runCommand(nil, t, "get", formatID(zendesktest.FixtureOpenTicketID)); err != nil {
+		t.Fatalf("second get failed: %s", err)
+	}
+	m, err = manifest.Load(folder)
+	if err != nil {
+		t.Fatalf("failed to load manifest: %s", err)
+	}
+	if !m.CreatedAt.Equal(createdAt) || !m.UpdatedAt.After(createdAt) {
+		t.Errorf("unexpected timestamps created=%s updated=%s", m.CreatedAt, m.UpdatedAt)
+	}
+}
+
+func TestGetStages(t *testing.T) {
+	_, workDir := setupTest(t)
+	viper.Set("get.cs-repro-repo", makeCSReproRepo(t))
+	folder := ticketFolder(workDir, zendesktest.FixtureOpenTicketID)
+
+	if err := runCommand(nil, t, "get", formatID(zendesktest.FixtureOpenTicketID), "--skip", "repro,compose"); err != nil {
+		t.Fatalf("get failed: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(folder, "latest-support-packet", "support_packet.yaml")); err != nil {
+		t.Errorf("support packet was not extracted: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(folder, "cs-repro")); err == nil {
+		t.Error("the repro should not be cloned")
+	}
+
+	if err := runCommand(nil, t, "get", formatID(zendesktest.FixtureOpenTicketID), "--only", "repro,compose"); err != nil {
+		t.Fatalf("get failed: %s", err)
+	}
+	compose, err := os.ReadFile(filepath.Join(folder, "cs-repro", "docker-compose.yml"))
+	if err != nil {
+		t.Fatalf("failed to read docker-compose.yml: %s", err)
+	}
+	// the version comes from the support packet extracted by the first run
+	if !strings.Contains(string(compose), "mattermost-enterprise-edition:"+zendesktest.FixtureServerVersion) {
+		t.Errorf("docker-compose.yml should use the support packet version:\n%s", compose)
+	}
+
+	if err := runCommand(nil, t, "get", formatID(zendesktest.FixtureOpenTicketID), "--only", "download"); err == nil {
+		t.Error("expected an error for an unknown stage")
+	}
+}
@@ -3,40 +3,139 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"io"
 	"log"
-	"os"
-	"path/filepath"
+	"os/user"
+	"text/tabwriter"
+	"time"
 
+	"github.com/julientant/supportctl/workspace"
 	"github.com/spf13/cobra"
 )
 
 // keepCmd represents the keep command
 var keepCmd = &cobra.Command{
 	Use:       "keep [ticket number]",
-	Args:      cobra.ExactArgs(1),
+	Args:      cobra.MaximumNArgs(1),
 	ValidArgs: []string{"ticket number"},
 	Short:     "Make sure prune does not remove this ticket folder",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if list, _ := cmd.Flags().GetBool("list"); list {
+			return listKeptFolders(cmd.OutOrStdout())
+		}
+
+		if len(args) != 1 {
+			return errors.New("a ticket number is required")
+		}
+
 		ticketNumber := args[0]
+		id, err := workspace.ParseTicketID(ticketNumber)
+		if err != nil {
+			return err
+		}
 
 		if !ticketFolderExists(ticketNumber) {
 			return errors.New("ticket folder does not exist")
 		}
 
-		// create a .supportctl-keep file
-		keepFilePath := filepath.Join(getTicketFolderPath(ticketNumber), ".supportctl-keep")
-		f, err := os.Create(keepFilePath)
+		ws, err := openWorkspace()
+		if err != nil {
+			return err
+		}
+		lock, err := lockTicket(ws, id)
 		if err != nil {
-			return fmt.Errorf("failed to create keep file: %w", err)
+			return err
 		}
-		defer f.Close()
+		defer lock.Unlock()
 
-		log.Printf("Created keep file: %s for ticket %s", keepFilePath, ticketNumber)
+		reason, _ := cmd.Flags().GetString("reason")
+		k := workspace.Keep{
+			By:        currentUserName(),
+			Reason:    reason,
+			CreatedAt: time.Now(),
+		}
+
+		if until, _ := cmd.Flags().GetString("until"); until != "" {
+			t, err := time.ParseInLocation(workspace.KeepDateFormat, until, time.Local)
+			if err != nil {
+				return fmt.Errorf("--until must be a date like 2026-12-31: %w", err)
+			}
+			k.Until = &t
+			if k.Expired(time.Now()) {
+				return fmt.Errorf("--until %s is in the past", until)
+			}
+		}
+
+		if err := workspace.WriteKeep(getTicketFolderPath(ticketNumber), k); err != nil {
+			return err
+		}
+
+		if k.Until != nil {
+			log.Printf("Keeping ticket %s until %s", ticketNumber, k.Until.Format(workspace.KeepDateFormat))
+		} else {
+			log.Printf("Keeping ticket %s", ticketNumber)
+		}
 
 		return nil
 	},
 }
 
+// listKeptFolders prints the kept ticket folders, expired keeps included since prune is about to remove them
+func listKeptFolders(out io.Writer) error {
+	ws, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+
+	folders, err := scanWorkspace(ws)
+	if err != nil {
+		return fmt.Errorf("failed to list ticket folders: %w", err)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TICKET\tBY\tSINCE\tUNTIL\tREASON")
+	for _, f := range folders {
+		k, err := workspace.ReadKeep(f.Path)
+		if err != nil {
+			log.Printf("Failed to read keep of ticket %d: %s", f.ID, err)
+			continue
+		}
+		if k == nil {
+			continue
+		}
+
+		since := "-"
+		if !k.CreatedAt.IsZero() {
+			since = k.CreatedAt.Local().Format(workspace.KeepDateFormat)
+		}
+		until := "forever"
+		if k.Until != nil {
+			until = k.Until.Format(workspace.KeepDateFormat)
+			if k.Expired(time.Now()) {
+				until += " (expired)"
+			}
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", f.ID, orDash(k.By), since, until, orDash(k.Reason))
+	}
+
+	return w.Flush()
+}
+
+// currentUserName returns who runs supportctl, for the records it writes
+func currentUserName() string {
+	u, err := user.Current()
+	if err != nil {
+		return ""
+	}
+
+	return u.Username
+}
+
 func init() {
 	rootCmd.AddCommand(keepCmd)
+
+	keepCmd.Flags().String("reason", "", "why the folder must be kept")
+	keepCmd.Flags().String("until", "", "keep the folder until this date, e.g. 2026-12-31")
+	keepCmd.Flags().Bool("list", false, "list the kept ticket folders")
 }
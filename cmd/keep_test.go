@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julientant/supportctl/workspace"
+	"github.com/julientant/supportctl/zendesk/zendesktest"
+)
+
+func TestKeepReasonAndUnkeep(t *testing.T) {
+	_, workDir := setupTest(t)
+
+	folder := ticketFolder(workDir, zendesktest.FixtureSolvedOldID)
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	until := time.Now().AddDate(0, 1, 0).Format(workspace.KeepDateFormat)
+	if err := runCommand(nil, t, "keep", formatID(zendesktest.FixtureSolvedOldID), "--reason", "escalated to eng", "--until", until); err != nil {
+		t.Fatalf("keep failed: %s", err)
+	}
+
+	k, err := workspace.ReadKeep(folder)
+	if err != nil || k == nil {
+		t.Fatalf("keep file should have been written: %v", err)
+	}
+	if k.Reason != "escalated to eng" || k.Until == nil || k.Until.Format(workspace.KeepDateFormat) != until {
+		t.Errorf("unexpected keep %+v", k)
+	}
+
+	out := &bytes.Buffer{}
+	rootCmd.SetOut(out)
+	defer rootCmd.SetOut(nil)
+	if err := runCommand(nil, t, "keep", "--list"); err != nil {
+		t.Fatalf("keep --list failed: %s", err)
+	}
+	if !strings.Contains(out.String(), "escalated to eng") || !strings.Contains(out.String(), until) {
+		t.Errorf("keep --list should show the reason and expiry, got:\n%s", out)
+	}
+
+	if err := runCommand(nil, t, "unkeep", formatID(zendesktest.FixtureSolvedOldID)); err != nil {
+		t.Fatalf("unkeep failed: %s", err)
+	}
+	if k, _ := workspace.ReadKeep(folder); k != nil {
+		t.Error("keep file should have been removed")
+	}
+}
+
+func TestPruneIgnoresExpiredKeep(t *testing.T) {
+	_, workDir := setupTest(t)
+
+	folder := ticketFolder(workDir, zendesktest.FixtureSolvedOldID)
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		t.Fatal(err)
+	}
+	expired := time.Now().AddDate(0, 0, -2)
+	if err := workspace.WriteKeep(folder, workspace.Keep{Reason: "waiting for customer", Until: &expired}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runCommand(nil, t, "prune", "--yes"); err != nil {
+		t.Fatalf("prune failed: %s", err)
+	}
+
+	if _, err := os.Stat(folder); !os.IsNotExist(err) {
+		t.Error("folder with an expired keep should have been removed")
+	}
+}
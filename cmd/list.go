@@ -0,0 +1,316 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/julientant/supportctl/manifest"
+	"github.com/julientant/supportctl/workspace"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+type ticketListEntry struct {
+	ID           int64      `json:"id"`
+	Folder       string     `json:"folder"`
+	Subject      string     `json:"subject"`
+	Status       string     `json:"status"`
+	Assignee     string     `json:"assignee"`
+	UpdatedAt    *time.Time `json:"updated_at,omitempty"`
+	Size         int64      `json:"size"`
+	Kept         bool       `json:"kept"`
+	ReproRunning bool       `json:"repro_running"`
+	// Source tells if the ticket details come from zendesk or the cached manifest
+	Source string `json:"source"`
+}
+
+// listCmd represents the list command
+var listCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List the ticket folders of the work dir",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ws, err := openWorkspace()
+		if err != nil {
+			return err
+		}
+
+		folders, err := scanWorkspace(ws)
+		if err != nil {
+			return fmt.Errorf("failed to list ticket folders: %w", err)
+		}
+
+		entries := make([]*ticketListEntry, 0, len(folders))
+		for _, f := range folders {
+			entries = append(entries, localTicketListEntry(f))
+		}
+
+		if !viper.GetBool("list.offline") && len(entries) > 0 {
+			if err := refreshTicketListEntries(cmd.Context(), entries); err != nil {
+				log.Printf("Could not reach zendesk, using cached details: %s", err)
+			}
+		}
+
+		running := runningReproProjects(cmd.Context())
+		for _, e := range entries {
+			e.ReproRunning = running["cs-repro-"+strconv.FormatInt(e.ID, 10)]
+		}
+
+		entries = filterTicketListEntries(entries)
+		if err := sortTicketListEntries(entries, viper.GetString("list.sort")); err != nil {
+			return err
+		}
+
+		switch output := viper.GetString("list.output"); output {
+		case "json":
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			return enc.Encode(entries)
+		case "table":
+			printTicketListEntries(cmd.OutOrStdout(), entries)
+			return nil
+		default:
+			return fmt.Errorf("unknown output %q, must be table or json", output)
+		}
+	},
+}
+
+// localTicketListEntry describes a ticket folder from what is on disk
+func localTicketListEntry(f workspace.Folder) *ticketListEntry {
+	entry := &ticketListEntry{
+		ID:     f.ID,
+		Folder: f.Path,
+		Size:   folderSize(f.Path),
+		Kept:   f.Kept(),
+	}
+
+	if m, err := manifest.Load(f.Path); err == nil {
+		entry.Subject = m.Ticket.Subject
+		entry.Status = m.Ticket.Status
+		entry.Assignee = m.Ticket.AssigneeName
+		entry.UpdatedAt = m.Ticket.UpdatedAt
+		entry.Source = "manifest"
+	}
+
+	return entry
+}
+
+// refreshTicketListEntries replaces the cached details with the live ones from zendesk
+func refreshTicketListEntries(ctx context.Context, entries []*ticketListEntry) error {
+	zd, err := newZendeskClient()
+	if err != nil {
+		return err
+	}
+
+	byID := map[int64]*ticketListEntry{}
+	ids := []int64{}
+	for _, e := range entries {
+		byID[e.ID] = e
+		ids = append(ids, e.ID)
+	}
+
+	users := map[int64]string{}
+	for i := 0; i < len(ids); i += 100 {
+		tickets, err := zd.GetMultipleTickets(ctx, ids[i:min(i+100, len(ids))])
+		if err != nil {
+			return err
+		}
+
+		for _, ticket := range tickets {
+			e := byID[ticket.ID]
+			e.Subject = ticket.Subject
+			e.Status = ticket.Status
+			e.UpdatedAt = ticket.UpdatedAt
+			e.Source = "zendesk"
+
+			e.Assignee = ""
+			if ticket.AssigneeID == 0 {
+				continue
+			}
+			if _, ok := users[ticket.AssigneeID]; !ok {
+				user, err := zd.GetUser(ctx, ticket.AssigneeID)
+				if err != nil {
+					log.Printf("Failed to retrieve assignee of ticket %d: %s", ticket.ID, err)
+				}
+				users[ticket.AssigneeID] = user.Name
+			}
+			e.Assignee = users[ticket.AssigneeID]
+		}
+	}
+
+	return nil
+}
+
+// runningReproProjects returns the docker compose projects with running containers.
+// Docker being unavailable simply means nothing is running.
+func runningReproProjects(ctx context.Context) map[string]bool {
+	running := map[string]bool{}
+	out, err := exec.CommandContext(ctx, "docker", "ps", "--format", `{{.Label "com.docker.compose.project"}}`).Output()
+	if err != nil {
+		return running
+	}
+
+	for _, project := range strings.Fields(string(out)) {
+		running[project] = true
+	}
+
+	return running
+}
+
+func filterTicketListEntries(entries []*ticketListEntry) []*ticketListEntry {
+	statuses := viper.GetStringSlice("list.status")
+	keptOnly := viper.GetBool("list.kept")
+
+	filtered := []*ticketListEntry{}
+	for _, e := range entries {
+		if keptOnly && !e.Kept {
+			continue
+		}
+		if len(statuses) > 0 && !containsString(statuses, e.Status) {
+			continue
+		}
+		filtered = append(filtered, e)
+	}
+
+	return filtered
+}
+
+func sortTicketListEntries(entries []*ticketListEntry, by string) error {
+	var less func(a, b *ticketListEntry) bool
+	switch by {
+	case "id":
+		less = func(a, b *ticketListEntry) bool { return a.ID < b.ID }
+	case "updated":
+		less = func(a, b *ticketListEntry) bool {
+			if a.UpdatedAt == nil || b.UpdatedAt == nil {
+				return b.UpdatedAt == nil && a.UpdatedAt != nil
+			}
+			return a.UpdatedAt.After(*b.UpdatedAt)
+		}
+	case "size":
+		less = func(a, b *ticketListEntry) bool { return a.Size > b.Size }
+	case "status":
+		less = func(a, b *ticketListEntry) bool { return a.Status < b.Status }
+	default:
+		return fmt.Errorf("unknown sort %q, must be id, updated, size or status", by)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return less(entries[i], entries[j])
+	})
+
+	return nil
+}
+
+func printTicketListEntries(out io.Writer, entries []*ticketListEntry) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TICKET\tSTATUS\tASSIGNEE\tUPDATED\tSIZE\tKEPT\tREPRO\tSUBJECT")
+	for _, e := range entries {
+		repro := "-"
+		if e.ReproRunning {
+			repro = "running"
+		}
+		updated := "-"
+		if e.UpdatedAt != nil {
+			updated = e.UpdatedAt.Local().Format("2006-01-02")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.ID,
+			orDash(e.Status),
+			orDash(e.Assignee),
+			updated,
+			formatSize(e.Size),
+			yesNo(e.Kept),
+			repro,
+			orDash(e.Subject),
+		)
+	}
+	w.Flush()
+}
+
+// folderSize returns the disk usage of a folder, unreadable files are ignored
+func folderSize(folder string) int64 {
+	var size int64
+	filepath.WalkDir(folder, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && !d.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+
+	return size
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f%cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+
+	return "no"
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+
+	listCmd.Flags().Bool("list.offline", false, "only use the details cached in the ticket folders")
+	viper.BindPFlag("list.offline", listCmd.Flags().Lookup("list.offline"))
+
+	listCmd.Flags().String("list.sort", "id", "sort by id, updated, size or status")
+	viper.BindPFlag("list.sort", listCmd.Flags().Lookup("list.sort"))
+
+	listCmd.Flags().StringSlice("list.status", nil, "only show tickets with these statuses")
+	viper.BindPFlag("list.status", listCmd.Flags().Lookup("list.status"))
+
+	listCmd.Flags().Bool("list.kept", false, "only show kept tickets")
+	viper.BindPFlag("list.kept", listCmd.Flags().Lookup("list.kept"))
+
+	listCmd.Flags().String("list.output", "table", "output format, table or json")
+	viper.BindPFlag("list.output", listCmd.Flags().Lookup("list.output"))
+}
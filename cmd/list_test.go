@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/julientant/supportctl/manifest"
+	"github.com/julientant/supportctl/zendesk/zendesktest"
+	"github.com/spf13/viper"
+)
+
+func TestList(t *testing.T) {
+	_, workDir := setupTest(t)
+
+	for _, id := range []int64{zendesktest.FixtureOpenTicketID, zendesktest.FixtureSolvedOldID} {
+		if err := os.MkdirAll(ticketFolder(workDir, id), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(ticketFolder(workDir, zendesktest.FixtureSolvedOldID), ".supportctl-keep"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := manifest.Save(ticketFolder(workDir, zendesktest.FixtureSolvedOldID), &manifest.Manifest{
+		Ticket: manifest.Ticket{ID: zendesktest.FixtureSolvedOldID, Subject: "cached subject", Status: "pending"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := func() []ticketListEntry {
+		t.Helper()
+
+		out := &bytes.Buffer{}
+		rootCmd.SetOut(out)
+		defer rootCmd.SetOut(nil)
+
+		viper.Set("list.output", "json")
+		if err := runCommand(nil, t, "list"); err != nil {
+			t.Fatalf("list failed: %s", err)
+		}
+
+		entries := []ticketListEntry{}
+		if err := json.Unmarshal(out.Bytes(), &entries); err != nil {
+			t.Fatalf("failed to decode output %q: %s", out, err)
+		}
+		return entries
+	}
+
+	entries := list()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 tickets, got %+v", entries)
+	}
+	if entries[0].ID != zendesktest.FixtureOpenTicketID || entries[0].Status != "open" || entries[0].Source != "zendesk" {
+		t.Errorf("unexpected entry %+v", entries[0])
+	}
+	if entries[1].Subject != "How do I configure SAML?" || !entries[1].Kept || entries[1].Size == 0 {
+		t.Errorf("unexpected entry %+v", entries[1])
+	}
+
+	// offline, the manifest is used
+	viper.Set("list.offline", true)
+	viper.Set("list.kept", true)
+	entries = list()
+	if len(entries) != 1 || entries[0].Subject != "cached subject" || entries[0].Source != "manifest" {
+		t.Errorf("unexpected offline entries %+v", entries)
+	}
+}
@@ -4,11 +4,13 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
 	"github.com/julientant/supportctl/zendesk"
 	"github.com/manifoldco/promptui"
+	zdlib "github.com/nukosuke/go-zendesk/zendesk"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -16,7 +18,10 @@ import (
 // loginCmd represents the login command
 var loginCmd = &cobra.Command{
 	Use:   "login",
-	Short: "Login to zendesk to retrieve a token",
+	Short: "Login to zendesk and save the credentials",
+	Annotations: map[string]string{
+		allowNewProfileAnnotation: "",
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// get subdomain, email
 		subdomain := viper.GetString("zendesk.subdomain")
@@ -36,8 +41,18 @@ var loginCmd = &cobra.Command{
 			return fmt.Errorf("Error getting subdomain from prompt: %s \n", err)
 		}
 
+		authModePrompt := promptui.Select{
+			Label: "Authentication mode",
+			Items: []string{zendesk.AuthModeOAuth, zendesk.AuthModeAPIToken},
+		}
+		_, authMode, err := authModePrompt.Run()
+		if err != nil {
+			return fmt.Errorf("Error getting authentication mode from prompt: %s \n", err)
+		}
+
 		emailPrompt := promptui.Prompt{
-			Label: "Email",
+			Label:   "Email",
+			Default: viper.GetString("zendesk.email"),
 			Validate: func(input string) error {
 				if len(input) == 0 {
 					return fmt.Errorf("Email cannot be empty")
@@ -56,45 +71,96 @@ var loginCmd = &cobra.Command{
 			return fmt.Errorf("Error getting email from prompt: %s \n", err)
 		}
 
-		// ask for password
-		passwordPrompt := promptui.Prompt{
-			Label: "Password",
-			Mask:  '*',
-			Validate: func(input string) error {
-				if len(input) == 0 {
-					return fmt.Errorf("Password cannot be empty")
-				}
-				return nil
-			},
+		var values map[string]any
+		if authMode == zendesk.AuthModeAPIToken {
+			values, err = loginWithAPIToken(cmd.Context(), subdomain, email)
+		} else {
+			values, err = loginWithOAuth(cmd.Context(), subdomain, email)
 		}
-		password, err := passwordPrompt.Run()
 		if err != nil {
-			return fmt.Errorf("Error getting password from prompt: %s \n", err)
+			return err
 		}
 
-		zd, err := zendesk.NewClient(subdomain, "")
-		if err != nil {
-			return fmt.Errorf("Error creating zendesk client: %s \n", err)
-		}
-
-		result, err := zd.GetBearerToken(cmd.Context(), email, password)
-		if err != nil {
-			return fmt.Errorf("Error getting bearer token: %s \n", err)
-		}
-
-		viper.Set("zendesk.subdomain", subdomain)
-		viper.Set("zendesk.bearer-token", result)
-
-		err = viper.WriteConfig()
+		values[profileKey("zendesk.subdomain")] = subdomain
+		values[profileKey("zendesk.auth-mode")] = authMode
+		values[profileKey("zendesk.email")] = email
+		err = saveConfig(values)
 		if err != nil {
 			return fmt.Errorf("Error writing config: %s \n", err)
 		}
 
-		fmt.Println("Subdomain and Token saved to config file")
+		fmt.Println("Subdomain and credentials saved to config file")
 		return nil
 	},
 }
 
+func loginWithOAuth(ctx context.Context, subdomain, email string) (map[string]any, error) {
+	// ask for password
+	passwordPrompt := promptui.Prompt{
+		Label: "Password",
+		Mask:  '*',
+		Validate: func(input string) error {
+			if len(input) == 0 {
+				return fmt.Errorf("Password cannot be empty")
+			}
+			return nil
+		},
+	}
+	password, err := passwordPrompt.Run()
+	if err != nil {
+		return nil, fmt.Errorf("Error getting password from prompt: %s \n", err)
+	}
+
+	zd, err := zendesk.NewClient(subdomain, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating zendesk client: %s \n", err)
+	}
+
+	result, err := zd.GetBearerToken(ctx, email, password)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting bearer token: %s \n", err)
+	}
+
+	return map[string]any{
+		profileKey("zendesk.bearer-token"): result,
+	}, nil
+}
+
+func loginWithAPIToken(ctx context.Context, subdomain, email string) (map[string]any, error) {
+	tokenPrompt := promptui.Prompt{
+		Label: "API token",
+		Mask:  '*',
+		Validate: func(input string) error {
+			if len(input) == 0 {
+				return fmt.Errorf("API token cannot be empty")
+			}
+			return nil
+		},
+	}
+	token, err := tokenPrompt.Run()
+	if err != nil {
+		return nil, fmt.Errorf("Error getting API token from prompt: %s \n", err)
+	}
+
+	zd, err := zendesk.NewClient(subdomain, zdlib.NewAPITokenCredential(email, token), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating zendesk client: %s \n", err)
+	}
+
+	// unlike the password grant, nothing checked the token yet
+	_, err = zd.GetCurrentUser(ctx)
+	if zendesk.IsUnauthorized(err) {
+		return nil, fmt.Errorf("Zendesk rejected the email and API token \n")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error validating API token: %s \n", err)
+	}
+
+	return map[string]any{
+		profileKey("zendesk.api-token"): token,
+	}, nil
+}
+
 func init() {
 	rootCmd.AddCommand(loginCmd)
 
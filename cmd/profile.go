@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/julientant/supportctl/zendesk"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// profileCmd represents the profile command
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Manage the zendesk profiles",
+}
+
+var profileListCmd = &cobra.Command{
+	Use: "list",
+	Annotations: map[string]string{
+		allowNewProfileAnnotation: "",
+	},
+	Short: "List the profiles defined in the config file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		names := profileNames()
+		if len(names) == 0 {
+			fmt.Println("No profile defined")
+			return nil
+		}
+
+		for _, name := range names {
+			marker := " "
+			if name == activeProfile() {
+				marker = "*"
+			}
+			fmt.Printf("%s %s (%s)\n", marker, name, viper.GetString("profiles."+name+".zendesk.subdomain"))
+		}
+
+		return nil
+	},
+}
+
+var profileUseCmd = &cobra.Command{
+	Use: "use [profile]",
+	Annotations: map[string]string{
+		allowNewProfileAnnotation: "",
+	},
+	Args:  cobra.ExactArgs(1),
+	Short: "Make a profile the default one",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		if !profileExists(name) {
+			return fmt.Errorf("profile %q is not defined in the config file", name)
+		}
+
+		err := saveConfig(map[string]any{"profile": name})
+		if err != nil {
+			return fmt.Errorf("failed to save default profile: %w", err)
+		}
+
+		fmt.Printf("Now using profile %s\n", name)
+		return nil
+	},
+}
+
+var profileShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the settings of the active profile",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profile := activeProfile()
+		if profile == "" {
+			profile = "(none)"
+		}
+
+		workDir, err := filepath.Abs(viper.GetString("work-dir"))
+		if err != nil {
+			return fmt.Errorf("failed to get absolute path: %w", err)
+		}
+
+		fmt.Printf("Profile:   %s\n", profile)
+		fmt.Printf("Subdomain: %s\n", viper.GetString("zendesk.subdomain"))
+		fmt.Printf("Auth mode: %s\n", viper.GetString("zendesk.auth-mode"))
+		if viper.GetString("zendesk.auth-mode") == zendesk.AuthModeAPIToken {
+			fmt.Printf("Email:     %s\n", viper.GetString("zendesk.email"))
+			fmt.Printf("API token: %s\n", redact(viper.GetString("zendesk.api-token")))
+		} else {
+			fmt.Printf("Token:     %s\n", redact(viper.GetString("zendesk.bearer-token")))
+		}
+		fmt.Printf("Work dir:  %s\n", workDir)
+		return nil
+	},
+}
+
+// redact hides most of a secret, keeping just enough to recognize it
+func redact(secret string) string {
+	if secret == "" {
+		return "(not set)"
+	}
+	if len(secret) <= 8 {
+		return "********"
+	}
+
+	return secret[:4] + "********"
+}
+
+func init() {
+	rootCmd.AddCommand(profileCmd)
+
+	profileCmd.AddCommand(profileListCmd)
+	profileCmd.AddCommand(profileUseCmd)
+	profileCmd.AddCommand(profileShowCmd)
+}
@@ -1,56 +1,48 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"path/filepath"
-	"strconv"
-	"strings"
-	"time"
 
-	"github.com/julientant/supportctl/zendesk"
+	"github.com/julientant/supportctl/workspace"
+	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 // pruneCmd represents the prune command
 var pruneCmd = &cobra.Command{
-	Use:   "prune",
-	Short: "remove old ticket folders",
+	Use:     "prune",
+	Short:   "remove old ticket folders according to the prune policies",
+	PreRunE: mustHaveZendeskConfig,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		workDir, err := ensureWorkingDir()
+		ws, err := openWorkspace()
 		if err != nil {
-			return fmt.Errorf("failed to ensure working dir: %w", err)
+			return err
 		}
 
-		zd, err := zendesk.NewClientFromViper(viper.GetViper())
+		zd, err := newZendeskClient()
 		if err != nil {
 			return fmt.Errorf("failed to create zendesk client: %w", err)
 		}
 
+		folders, err := scanWorkspace(ws)
+		if err != nil {
+			return fmt.Errorf("failed to list ticket folders: %w", err)
+		}
+
 		ticketsToCheck := []int64{}
-		filepath.Walk(workDir, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return fmt.Errorf("failed to walk: %w", err)
+		for _, f := range folders {
+			if f.Kept() {
+				continue
 			}
-
-			if info.IsDir() && info.Name() != workDir {
-				if strings.HasPrefix(info.Name(), "ZD-") {
-					if _, err := os.Stat(filepath.Join(path, ".supportctl-keep")); err == nil {
-						return nil
-					}
-
-					idStr := strings.TrimPrefix(info.Name(), "ZD-")
-					id, err := strconv.ParseInt(idStr, 10, 64)
-					if err != nil {
-						return fmt.Errorf("failed to parse ticket id: %w", err)
-					}
-					ticketsToCheck = append(ticketsToCheck, id)
-				}
+			if k, _ := workspace.ReadKeep(f.Path); k != nil && k.Until != nil {
+				log.Printf("Keep of ticket %d expired on %s", f.ID, k.Until.Format(workspace.KeepDateFormat))
 			}
-			return nil
-		})
+			ticketsToCheck = append(ticketsToCheck, f.ID)
+		}
 
 		if len(ticketsToCheck) == 0 {
 			log.Println("No tickets to check")
@@ -68,28 +60,111 @@ var pruneCmd = &cobra.Command{
 			chunks = append(chunks, ticketsToCheck[i:end])
 		}
 
-		closedSinceInDays := viper.GetInt("prune.closed-since-days")
-		if closedSinceInDays <= 0 {
-			log.Println("prune.closed-since-days must be greater than 0, using 30 days")
-			closedSinceInDays = 30
+		policies, err := loadPrunePolicies()
+		if err != nil {
+			return err
 		}
 
+		tickets := []pruneTicket{}
 		for _, chunk := range chunks {
-			tickets, err := zd.GetMultipleTickets(cmd.Context(), chunk)
+			found, err := zd.GetMultipleTickets(cmd.Context(), chunk)
 			if err != nil {
 				return fmt.Errorf("failed to retrieve tickets: %w", err)
 			}
 
-			for _, ticket := range tickets {
-				switch ticket.Status {
-				case "solved", "closed":
-					if ticket.UpdatedAt.AddDate(0, 0, closedSinceInDays).Before(time.Now()) {
-						log.Printf("Removing folder for ticket %d\n", ticket.ID)
-						if err := os.RemoveAll(getTicketFolderPath(strconv.FormatInt(ticket.ID, 10))); err != nil {
-							return fmt.Errorf("failed to remove folder: %w", err)
-						}
-					}
+			returned := map[int64]bool{}
+			for _, ticket := range found {
+				returned[ticket.ID] = true
+				tickets = append(tickets, newPruneTicket(cmd.Context(), zd, ticket))
+			}
+
+			// zendesk silently leaves out the tickets that were deleted or that the user cannot access
+			for _, id := range chunk {
+				if returned[id] {
+					continue
+				}
+
+				t, err := missingTicket(cmd.Context(), zd, id)
+				if err != nil {
+					log.Printf("Skipping ticket %d: %s", id, err)
+					continue
+				}
+				tickets = append(tickets, t)
+			}
+		}
+
+		candidates := evaluatePrunePolicies(cmd.Context(), zd, policies, tickets)
+		candidates, err = applyOrphanAction(tickets, candidates)
+		if err != nil {
+			return err
+		}
+		candidates, err = applySizeCap(folders, tickets, candidates)
+		if err != nil {
+			return err
+		}
+
+		printOrphanReport(cmd.OutOrStdout(), tickets, candidates)
+
+		if len(candidates) == 0 {
+			log.Println("No ticket folder to prune")
+			return nil
+		}
+
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		yes, _ := cmd.Flags().GetBool("yes")
+
+		printPruneReport(cmd.OutOrStdout(), candidates)
+		if dryRun {
+			return nil
+		}
+
+		if !yes {
+			confirmPrompt := promptui.Prompt{
+				Label:     fmt.Sprintf("Prune these %d folders", len(candidates)),
+				IsConfirm: true,
+			}
+			if _, err := confirmPrompt.Run(); err != nil {
+				if errors.Is(err, promptui.ErrAbort) {
+					log.Println("Nothing pruned")
+					return nil
 				}
+				return fmt.Errorf("failed to confirm, use --yes to prune without confirmation: %w", err)
+			}
+		}
+
+		// the workspace is only locked for the pruning itself, not while the user reads the report
+		indexLock, err := lockIndex(ws)
+		if err != nil {
+			return err
+		}
+		defer indexLock.Unlock()
+
+		for _, c := range candidates {
+			lock, err := lockTicket(ws, c.ID)
+			if errors.Is(err, workspace.ErrBusy) {
+				log.Printf("Skipping %s: %s", c.Folder, err)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			// the folder may have been removed or kept since it was scanned
+			if _, err := os.Stat(c.Folder); err != nil {
+				lock.Unlock()
+				log.Printf("Skipping %s: %s", c.Folder, err)
+				continue
+			}
+			if (workspace.Folder{ID: c.ID, Path: c.Folder}).Kept() {
+				lock.Unlock()
+				log.Printf("Skipping %s: it is now kept", c.Folder)
+				continue
+			}
+
+			err = applyPruneAction(c)
+			lock.Unlock()
+			if err != nil {
+				return err
 			}
 		}
 
@@ -102,4 +177,19 @@ func init() {
 
 	pruneCmd.Flags().Int("prune.closed-since-days", 30, "removed tickets folder that have been closed for more than this number of days")
 	viper.BindPFlag("prune.closed-since-days", pruneCmd.Flags().Lookup("prune.closed-since-days"))
+
+	pruneCmd.Flags().String("prune.mode", pruneActionDelete, "what to do with old ticket folders, delete or archive")
+	viper.BindPFlag("prune.mode", pruneCmd.Flags().Lookup("prune.mode"))
+
+	pruneCmd.Flags().Bool("prune.archive-exclude-packets", false, "leave the downloaded support packets out of the archives")
+	viper.BindPFlag("prune.archive-exclude-packets", pruneCmd.Flags().Lookup("prune.archive-exclude-packets"))
+
+	pruneCmd.Flags().String("prune.max-work-dir-size", "", "remove the least recently used closed tickets until the work dir fits in this size, e.g. 50GB")
+	viper.BindPFlag("prune.max-work-dir-size", pruneCmd.Flags().Lookup("prune.max-work-dir-size"))
+
+	pruneCmd.Flags().String("prune.orphan-action", pruneActionReport, "what to do with folders of deleted, merged or inaccessible tickets no policy matched: report, delete, archive or delete-attachments")
+	viper.BindPFlag("prune.orphan-action", pruneCmd.Flags().Lookup("prune.orphan-action"))
+
+	pruneCmd.Flags().Bool("dry-run", false, "only show the folders that would be removed")
+	pruneCmd.Flags().BoolP("yes", "y", false, "remove the folders without asking for confirmation")
 }
@@ -0,0 +1,541 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/julientant/supportctl/manifest"
+	"github.com/julientant/supportctl/ticketprep"
+	"github.com/julientant/supportctl/workspace"
+	"github.com/julientant/supportctl/zendesk"
+	zdlib "github.com/nukosuke/go-zendesk/zendesk"
+	"github.com/spf13/viper"
+)
+
+const (
+	pruneActionDelete            = "delete"
+	pruneActionArchive           = "archive"
+	pruneActionDeleteAttachments = "delete-attachments"
+	// pruneActionReport only reports orphans, it is not a policy action
+	pruneActionReport = "report"
+
+	// statuses given to tickets zendesk did not return
+	pruneStatusDeleted      = "deleted"
+	pruneStatusInaccessible = "inaccessible"
+
+	// orphanMerged is the orphan kind of tickets merged into another one, they keep their closed status
+	orphanMerged = "merged"
+
+	sizeCapPolicyName = "max-work-dir-size"
+	orphanPolicyName  = "orphan-action"
+
+	// maxMergeHops bounds how far prune follows tickets merged into merged tickets
+	maxMergeHops = 5
+)
+
+// prunePolicy is a rule of the prune.policies config, a ticket matches when all the set conditions match
+type prunePolicy struct {
+	Name          string   `mapstructure:"name"`
+	Statuses      []string `mapstructure:"statuses"`
+	Organizations []string `mapstructure:"organizations"`
+	Tags          []string `mapstructure:"tags"`
+	OlderThanDays int      `mapstructure:"older-than-days"`
+	Action        string   `mapstructure:"action"`
+}
+
+// pruneTicket is what the policies know about a ticket folder
+type pruneTicket struct {
+	ID             int64
+	Status         string
+	Tags           []string
+	OrganizationID int64
+	UpdatedAt      *time.Time
+	// Orphan is deleted, inaccessible or merged when the folder no longer follows a live ticket
+	Orphan     string
+	MergedInto int64
+}
+
+// pruneCandidate is a ticket folder a policy matched
+type pruneCandidate struct {
+	ID     int64
+	Folder string
+	Status string
+	Size   int64
+	Policy string
+	Action string
+}
+
+// loadPrunePolicies returns the configured policies, or the historical
+// closed-since-days rule when there are none
+func loadPrunePolicies() ([]prunePolicy, error) {
+	defaultAction := viper.GetString("prune.mode")
+	switch defaultAction {
+	case pruneActionDelete, pruneActionArchive, pruneActionDeleteAttachments:
+	default:
+		return nil, fmt.Errorf("unknown prune.mode %q, it must be %s, %s or %s", defaultAction, pruneActionDelete, pruneActionArchive, pruneActionDeleteAttachments)
+	}
+
+	policies := []prunePolicy{}
+	if err := viper.UnmarshalKey("prune.policies", &policies); err != nil {
+		return nil, fmt.Errorf("failed to read prune.policies: %w", err)
+	}
+
+	if len(policies) == 0 {
+		closedSinceInDays := viper.GetInt("prune.closed-since-days")
+		if closedSinceInDays <= 0 {
+			log.Println("prune.closed-since-days must be greater than 0, using 30 days")
+			closedSinceInDays = 30
+		}
+
+		policies = append(policies, prunePolicy{
+			Name:          "closed-since-days",
+			Statuses:      []string{"solved", "closed"},
+			OlderThanDays: closedSinceInDays,
+		})
+	}
+
+	for i := range policies {
+		p := &policies[i]
+		if p.Name == "" {
+			p.Name = "policy-" + strconv.Itoa(i+1)
+		}
+		if p.Action == "" {
+			p.Action = defaultAction
+		}
+
+		switch p.Action {
+		case pruneActionDelete, pruneActionArchive, pruneActionDeleteAttachments:
+		default:
+			return nil, fmt.Errorf("policy %s: unknown action %q", p.Name, p.Action)
+		}
+	}
+
+	return policies, nil
+}
+
+func (p prunePolicy) matches(t pruneTicket, orgName func(int64) string) bool {
+	if len(p.Statuses) > 0 && !containsString(p.Statuses, t.Status) {
+		return false
+	}
+
+	// a ticket of unknown age is not old enough
+	if p.OlderThanDays > 0 && (t.UpdatedAt == nil || t.UpdatedAt.AddDate(0, 0, p.OlderThanDays).After(time.Now())) {
+		return false
+	}
+
+	if len(p.Tags) > 0 {
+		found := false
+		for _, tag := range t.Tags {
+			if containsString(p.Tags, tag) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(p.Organizations) > 0 && (t.OrganizationID == 0 || !containsString(p.Organizations, orgName(t.OrganizationID))) {
+		return false
+	}
+
+	return true
+}
+
+// evaluatePrunePolicies returns the folders matched by a policy, the first matching policy wins
+func evaluatePrunePolicies(ctx context.Context, zd zendesk.API, policies []prunePolicy, tickets []pruneTicket) []pruneCandidate {
+	orgNames := map[int64]string{}
+	orgName := func(id int64) string {
+		if name, ok := orgNames[id]; ok {
+			return name
+		}
+
+		org, err := zd.GetOrganization(ctx, id)
+		if err != nil {
+			log.Printf("Failed to retrieve organization %d: %s", id, err)
+		}
+		orgNames[id] = org.Name
+		return org.Name
+	}
+
+	candidates := []pruneCandidate{}
+	for _, t := range tickets {
+		for _, p := range policies {
+			if !p.matches(t, orgName) {
+				continue
+			}
+
+			folder := getTicketFolderPath(strconv.FormatInt(t.ID, 10))
+			candidates = append(candidates, pruneCandidate{
+				ID:     t.ID,
+				Folder: folder,
+				Status: t.Status,
+				Size:   folderSize(folder),
+				Policy: p.Name,
+				Action: p.Action,
+			})
+			break
+		}
+	}
+
+	return candidates
+}
+
+// newPruneTicket describes a folder whose ticket zendesk returned
+func newPruneTicket(ctx context.Context, zd zendesk.API, ticket zdlib.Ticket) pruneTicket {
+	t := pruneTicket{
+		ID:             ticket.ID,
+		Status:         ticket.Status,
+		Tags:           ticket.Tags,
+		OrganizationID: ticket.OrganizationID,
+		UpdatedAt:      ticket.UpdatedAt,
+	}
+	followMerge(ctx, zd, &t)
+
+	return t
+}
+
+// missingTicket describes a folder whose ticket zendesk did not return,
+// the details come from the manifest since zendesk has none to give
+func missingTicket(ctx context.Context, zd zendesk.API, id int64) (pruneTicket, error) {
+	t := pruneTicket{ID: id}
+	if m, err := manifest.Load(getTicketFolderPath(strconv.FormatInt(id, 10))); err == nil {
+		t.Tags = m.Ticket.Tags
+		t.OrganizationID = m.Ticket.OrganizationID
+		t.UpdatedAt = m.Ticket.UpdatedAt
+	}
+
+	ticket, err := zd.GetTicket(ctx, id)
+	switch {
+	case zendesk.IsNotFound(err):
+		t.Status = pruneStatusDeleted
+	case zendesk.IsForbidden(err):
+		t.Status = pruneStatusInaccessible
+	case err != nil:
+		return t, fmt.Errorf("failed to retrieve ticket %d: %w", id, err)
+	default:
+		// zendesk can leave out a ticket it is still replicating, the ticket on its own is as good
+		return newPruneTicket(ctx, zd, ticket), nil
+	}
+	t.Orphan = t.Status
+
+	return t, nil
+}
+
+// followMerge finds the ticket a merged ticket ended up in, following merges of merged tickets
+func followMerge(ctx context.Context, zd zendesk.API, t *pruneTicket) {
+	if !containsString(t.Tags, zendesk.MergedTag) {
+		return
+	}
+	t.Orphan = orphanMerged
+
+	id := t.ID
+	for i := 0; i < maxMergeHops; i++ {
+		target, err := zd.GetMergeTarget(ctx, id)
+		if err != nil {
+			log.Printf("Failed to find the ticket %d was merged into: %s", id, err)
+			return
+		}
+		if target == 0 {
+			return
+		}
+		t.MergedInto = target
+
+		ticket, err := zd.GetTicket(ctx, target)
+		if err != nil || !containsString(ticket.Tags, zendesk.MergedTag) {
+			return
+		}
+		id = target
+	}
+}
+
+// applyOrphanAction adds the orphans no policy matched to the candidates when prune.orphan-action asks for it
+func applyOrphanAction(tickets []pruneTicket, candidates []pruneCandidate) ([]pruneCandidate, error) {
+	action := viper.GetString("prune.orphan-action")
+	switch action {
+	case pruneActionReport:
+		return candidates, nil
+	case pruneActionDelete, pruneActionArchive, pruneActionDeleteAttachments:
+	default:
+		return nil, fmt.Errorf("unknown prune.orphan-action %q", action)
+	}
+
+	selected := map[int64]bool{}
+	for _, c := range candidates {
+		selected[c.ID] = true
+	}
+
+	for _, t := range tickets {
+		if t.Orphan == "" || selected[t.ID] {
+			continue
+		}
+
+		folder := getTicketFolderPath(strconv.FormatInt(t.ID, 10))
+		candidates = append(candidates, pruneCandidate{
+			ID:     t.ID,
+			Folder: folder,
+			Status: t.Status,
+			Size:   folderSize(folder),
+			Policy: orphanPolicyName,
+			Action: action,
+		})
+	}
+
+	return candidates, nil
+}
+
+// applySizeCap adds closed tickets to the candidates, least recently used first,
+// until the ticket folders fit in prune.max-work-dir-size. The archives and the locks do not count,
+// archiving a folder moves it there.
+func applySizeCap(folders []workspace.Folder, tickets []pruneTicket, candidates []pruneCandidate) ([]pruneCandidate, error) {
+	sizeCap, err := parseSize(viper.GetString("prune.max-work-dir-size"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid prune.max-work-dir-size: %w", err)
+	}
+	if sizeCap <= 0 {
+		return candidates, nil
+	}
+
+	var total int64
+	for _, f := range folders {
+		total += folderSize(f.Path)
+	}
+	selected := map[int64]bool{}
+	for _, c := range candidates {
+		selected[c.ID] = true
+		total -= prunedSize(c.Folder, c.Action)
+	}
+
+	type evictable struct {
+		ticket   pruneTicket
+		lastUsed time.Time
+	}
+	closed := []evictable{}
+	for _, t := range tickets {
+		if selected[t.ID] || (t.Status != "solved" && t.Status != "closed") {
+			continue
+		}
+		closed = append(closed, evictable{t, folderLastUsed(getTicketFolderPath(strconv.FormatInt(t.ID, 10)))})
+	}
+	sort.Slice(closed, func(i, j int) bool {
+		return closed[i].lastUsed.Before(closed[j].lastUsed)
+	})
+
+	for _, e := range closed {
+		if total <= sizeCap {
+			break
+		}
+
+		folder := getTicketFolderPath(strconv.FormatInt(e.ticket.ID, 10))
+		action := viper.GetString("prune.mode")
+		candidates = append(candidates, pruneCandidate{
+			ID:     e.ticket.ID,
+			Folder: folder,
+			Status: e.ticket.Status,
+			Size:   folderSize(folder),
+			Policy: sizeCapPolicyName,
+			Action: action,
+		})
+		total -= prunedSize(folder, action)
+	}
+
+	if total > sizeCap {
+		log.Printf("The work dir will still use %s, more than prune.max-work-dir-size", formatSize(total))
+	}
+
+	return candidates, nil
+}
+
+// prunedSize returns how much the action frees in the folder
+func prunedSize(folder, action string) int64 {
+	if action != pruneActionDeleteAttachments {
+		return folderSize(folder)
+	}
+
+	var size int64
+	for _, path := range downloadedAttachments(folder) {
+		size += folderSize(path)
+	}
+
+	return size
+}
+
+// folderLastUsed returns the most recent modification of the folder or its direct content
+func folderLastUsed(folder string) time.Time {
+	var last time.Time
+	if info, err := os.Stat(folder); err == nil {
+		last = info.ModTime()
+	}
+
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		return last
+	}
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+	}
+
+	return last
+}
+
+// applyPruneAction runs the action of the policy that matched the folder
+func applyPruneAction(c pruneCandidate) error {
+	switch c.Action {
+	case pruneActionArchive:
+		log.Printf("Archiving folder %s\n", c.Folder)
+		if err := archiveTicketFolder(c.ID, "matched prune policy "+c.Policy); err != nil {
+			return fmt.Errorf("failed to archive folder: %w", err)
+		}
+		fallthrough
+	case pruneActionDelete:
+		log.Printf("Removing folder %s\n", c.Folder)
+		if err := os.RemoveAll(c.Folder); err != nil {
+			return fmt.Errorf("failed to remove folder: %w", err)
+		}
+	case pruneActionDeleteAttachments:
+		log.Printf("Removing downloaded attachments of %s\n", c.Folder)
+		if err := removeDownloadedAttachments(c.Folder); err != nil {
+			return fmt.Errorf("failed to remove attachments: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown prune action %q", c.Action)
+	}
+
+	return nil
+}
+
+// downloadedAttachments lists what get downloaded and extracted in the folder, the notes and the repro are not part of it
+func downloadedAttachments(folder string) []string {
+	paths := []string{filepath.Join(folder, ticketprep.SupportPacketDir)}
+	listed := map[string]bool{paths[0]: true}
+	add := func(path string) {
+		if !listed[path] {
+			listed[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	entries, _ := os.ReadDir(folder)
+	for _, e := range entries {
+		if !e.IsDir() && ticketprep.SupportPacketRegex.MatchString(e.Name()) {
+			add(filepath.Join(folder, e.Name()))
+		}
+	}
+	if m, err := manifest.Load(folder); err == nil {
+		for _, a := range m.Attachments {
+			add(filepath.Join(folder, a.FileName))
+		}
+	}
+
+	return paths
+}
+
+// removeDownloadedAttachments removes what get downloaded and extracted, keeping notes and the repro
+func removeDownloadedAttachments(folder string) error {
+	if _, err := os.Stat(folder); err != nil {
+		return err
+	}
+	toRemove := downloadedAttachments(folder)
+
+	m, err := manifest.Load(folder)
+	if err == nil {
+		m.Attachments = nil
+		if err := manifest.Save(folder, m); err != nil {
+			return err
+		}
+	}
+
+	for _, path := range toRemove {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// printPruneReport lists the folders prune is about to act on with the policy that matched them
+func printPruneReport(out io.Writer, candidates []pruneCandidate) {
+	var total int64
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TICKET\tSTATUS\tPOLICY\tACTION\tSIZE\tFOLDER")
+	for _, c := range candidates {
+		total += c.Size
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", c.ID, c.Status, c.Policy, c.Action, formatSize(c.Size), c.Folder)
+	}
+	fmt.Fprintf(w, "Total\t\t\t\t%s\t\n", formatSize(total))
+	w.Flush()
+}
+
+// printOrphanReport lists the folders whose ticket was deleted, merged or is no longer accessible,
+// with what prune does with them
+func printOrphanReport(out io.Writer, tickets []pruneTicket, candidates []pruneCandidate) {
+	actions := map[int64]string{}
+	for _, c := range candidates {
+		actions[c.ID] = c.Action
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	header := false
+	for _, t := range tickets {
+		if t.Orphan == "" {
+			continue
+		}
+		if !header {
+			fmt.Fprintln(w, "ORPHAN\tKIND\tMERGED INTO\tACTION")
+			header = true
+		}
+
+		mergedInto := "-"
+		if t.MergedInto != 0 {
+			mergedInto = strconv.FormatInt(t.MergedInto, 10)
+			if ticketFolderExists(mergedInto) {
+				mergedInto += " (local)"
+			}
+		}
+
+		action, ok := actions[t.ID]
+		if !ok {
+			action = pruneActionReport
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", t.ID, t.Orphan, mergedInto, action)
+	}
+	w.Flush()
+}
+
+// parseSize parses sizes like 500MB or 20GB, a plain number is in bytes
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return 0, nil
+	}
+
+	multiplier := int64(1)
+	for i, unit := range []string{"KB", "MB", "GB", "TB"} {
+		if strings.HasSuffix(s, unit) {
+			multiplier = int64(1) << (10 * (i + 1))
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit))
+			break
+		}
+	}
+	s = strings.TrimSuffix(s, "B")
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(n * float64(multiplier)), nil
+}
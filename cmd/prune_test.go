@@ -0,0 +1,474 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julientant/supportctl/workspace"
+	"github.com/julientant/supportctl/zendesk/zendesktest"
+	zdlib "github.com/nukosuke/go-zendesk/zendesk"
+	"github.com/spf13/viper"
+)
+
+func TestPrune(t *testing.T) {
+	_, workDir := setupTest(t)
+
+	for _, id := range []int64{
+		zendesktest.FixtureOpenTicketID,
+		zendesktest.FixtureSolvedOldID,
+		zendesktest.FixtureClosedRecentID,
+	} {
+		if err := os.MkdirAll(ticketFolder(workDir, id), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := runCommand(nil, t, "prune", "--yes"); err != nil {
+		t.Fatalf("prune failed: %s", err)
+	}
+
+	if _, err := os.Stat(ticketFolder(workDir, zendesktest.FixtureSolvedOldID)); !os.IsNotExist(err) {
+		t.Error("folder of the ticket solved 90 days ago should have been removed")
+	}
+	for _, id := range []int64{zendesktest.FixtureOpenTicketID, zendesktest.FixtureClosedRecentID} {
+		if _, err := os.Stat(ticketFolder(workDir, id)); err != nil {
+			t.Errorf("folder of ticket %d should have been kept: %s", id, err)
+		}
+	}
+}
+
+func TestPruneHonorsKeepFile(t *testing.T) {
+	_, workDir := setupTest(t)
+
+	folder := ticketFolder(workDir, zendesktest.FixtureSolvedOldID)
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := runCommand(nil, t, "keep", formatID(zendesktest.FixtureSolvedOldID)); err != nil {
+		t.Fatalf("keep failed: %s", err)
+	}
+
+	if err := runCommand(nil, t, "prune", "--yes"); err != nil {
+		t.Fatalf("prune failed: %s", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(folder, ".supportctl-keep")); err != nil {
+		t.Errorf("kept folder should not have been removed: %s", err)
+	}
+}
+
+func TestPruneDryRun(t *testing.T) {
+	_, workDir := setupTest(t)
+
+	folder := ticketFolder(workDir, zendesktest.FixtureSolvedOldID)
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	rootCmd.SetOut(out)
+	defer rootCmd.SetOut(nil)
+
+	if err := runCommand(nil, t, "prune", "--dry-run"); err != nil {
+		t.Fatalf("prune failed: %s", err)
+	}
+
+	if _, err := os.Stat(folder); err != nil {
+		t.Errorf("dry run should not remove anything: %s", err)
+	}
+	if !strings.Contains(out.String(), folder) {
+		t.Errorf("dry run should list %s, got:\n%s", folder, out)
+	}
+}
+
+func TestPruneArchiveAndRestore(t *testing.T) {
+	_, workDir := setupTest(t)
+	viper.Set("prune.mode", pruneActionArchive)
+	viper.Set("prune.archive-exclude-packets", true)
+
+	folder := ticketFolder(workDir, zendesktest.FixtureSolvedOldID)
+	for name, content := range map[string]string{
+		"notes.md": "customer uses SAML with ADFS",
+		"mattermost_support_packet_2023-09-01-10-00.zip": "packet",
+		"latest-support-packet/support_packet.yaml":      "server_version: 9.1.0",
+	} {
+		path := filepath.Join(folder, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := runCommand(nil, t, "prune", "--yes"); err != nil {
+		t.Fatalf("prune failed: %s", err)
+	}
+	if _, err := os.Stat(folder); !os.IsNotExist(err) {
+		t.Fatal("archived folder should have been removed")
+	}
+
+	if err := runCommand(nil, t, "restore", formatID(zendesktest.FixtureSolvedOldID)); err != nil {
+		t.Fatalf("restore failed: %s", err)
+	}
+
+	notes, err := os.ReadFile(filepath.Join(folder, "notes.md"))
+	if err != nil || string(notes) != "customer uses SAML with ADFS" {
+		t.Errorf("notes were not restored: %q %v", notes, err)
+	}
+	for _, name := range []string{"mattermost_support_packet_2023-09-01-10-00.zip", "latest-support-packet"} {
+		if _, err := os.Stat(filepath.Join(folder, name)); !os.IsNotExist(err) {
+			t.Errorf("%s should have been excluded from the archive", name)
+		}
+	}
+
+	if err := runCommand(nil, t, "restore", formatID(zendesktest.FixtureSolvedOldID)); err == nil {
+		t.Error("restoring over an existing folder should fail")
+	}
+}
+
+func TestPrunePolicies(t *testing.T) {
+	server, workDir := setupTest(t)
+
+	solvedAt := time.Now().AddDate(0, 0, -10)
+	server.AddTicket(zdlib.Ticket{ID: 2001, Status: "solved", OrganizationID: zendesktest.FixtureOrgID, UpdatedAt: &solvedAt})
+	server.AddTicket(zdlib.Ticket{ID: 2002, Status: "solved", Tags: []string{"escalated"}, UpdatedAt: &solvedAt})
+
+	viper.Set("prune.policies", []map[string]any{
+		{"name": "acme-packets", "organizations": []string{"Acme Corp"}, "statuses": []string{"solved"}, "older-than-days": 7, "action": "delete-attachments"},
+		{"name": "escalated", "tags": []string{"escalated"}, "older-than-days": 30},
+		{"name": "gone", "statuses": []string{"deleted"}},
+	})
+
+	for _, id := range []int64{2001, 2002, 4242} {
+		folder := ticketFolder(workDir, id)
+		for _, name := range []string{"notes.md", "mattermost_support_packet_2023-09-01-10-00.zip"} {
+			if err := os.MkdirAll(folder, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(folder, name), []byte(name), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	out := &bytes.Buffer{}
+	rootCmd.SetOut(out)
+	defer rootCmd.SetOut(nil)
+
+	if err := runCommand(nil, t, "prune", "--yes"); err != nil {
+		t.Fatalf("prune failed: %s", err)
+	}
+
+	// only the packet of the acme ticket is removed
+	if _, err := os.Stat(filepath.Join(ticketFolder(workDir, 2001), "notes.md")); err != nil {
+		t.Errorf("notes of the acme ticket should be kept: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(ticketFolder(workDir, 2001), "mattermost_support_packet_2023-09-01-10-00.zip")); !os.IsNotExist(err) {
+		t.Error("packet of the acme ticket should be removed")
+	}
+
+	// escalated ticket is not old enough yet
+	if _, err := os.Stat(ticketFolder(workDir, 2002)); err != nil {
+		t.Errorf("escalated ticket should be kept: %s", err)
+	}
+
+	// the ticket zendesk does not know about anymore is removed
+	if _, err := os.Stat(ticketFolder(workDir, 4242)); !os.IsNotExist(err) {
+		t.Error("deleted ticket should be removed")
+	}
+
+	for _, expected := range []string{"acme-packets", "gone"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("report should mention policy %s:\n%s", expected, out)
+		}
+	}
+}
+
+func TestPrunePolicyUnknownAge(t *testing.T) {
+	server, workDir := setupTest(t)
+	server.AddTicket(zdlib.Ticket{ID: 2003, Status: "solved"})
+
+	folder := ticketFolder(workDir, 2003)
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runCommand(nil, t, "prune", "--yes"); err != nil {
+		t.Fatalf("prune failed: %s", err)
+	}
+
+	if _, err := os.Stat(folder); err != nil {
+		t.Errorf("folder of a ticket without update time should be kept: %s", err)
+	}
+}
+
+func TestPruneSizeCap(t *testing.T) {
+	_, workDir := setupTest(t)
+	viper.Set("prune.policies", []map[string]any{
+		{"name": "never", "statuses": []string{"none"}},
+	})
+	viper.Set("prune.max-work-dir-size", "1KB")
+
+	for _, id := range []int64{zendesktest.FixtureOpenTicketID, zendesktest.FixtureClosedRecentID} {
+		folder := ticketFolder(workDir, id)
+		if err := os.MkdirAll(folder, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(folder, "big.log"), bytes.Repeat([]byte("x"), 2048), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := runCommand(nil, t, "prune", "--yes"); err != nil {
+		t.Fatalf("prune failed: %s", err)
+	}
+
+	if _, err := os.Stat(ticketFolder(workDir, zendesktest.FixtureClosedRecentID)); !os.IsNotExist(err) {
+		t.Error("closed ticket should be evicted to fit the size cap")
+	}
+	if _, err := os.Stat(ticketFolder(workDir, zendesktest.FixtureOpenTicketID)); err != nil {
+		t.Errorf("open ticket should never be evicted: %s", err)
+	}
+}
+
+func TestPruneSizeCapIgnoresArchives(t *testing.T) {
+	_, workDir := setupTest(t)
+	viper.Set("prune.policies", []map[string]any{
+		{"name": "never", "statuses": []string{"none"}},
+	})
+	viper.Set("prune.mode", pruneActionArchive)
+	viper.Set("prune.max-work-dir-size", "1KB")
+
+	folder := ticketFolder(workDir, zendesktest.FixtureClosedRecentID)
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(folder, "notes.md"), []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the archives of earlier runs alone are over the cap
+	if err := os.MkdirAll(filepath.Join(workDir, ".archive"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workDir, ".archive", "ZD-900.tar.gz"), bytes.Repeat([]byte("x"), 4096), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runCommand(nil, t, "prune", "--yes"); err != nil {
+		t.Fatalf("prune failed: %s", err)
+	}
+
+	if _, err := os.Stat(folder); err != nil {
+		t.Errorf("the ticket folders fit in the cap, nothing should be evicted: %s", err)
+	}
+}
+
+func TestPruneSizeCapDeleteAttachments(t *testing.T) {
+	server, workDir := setupTest(t)
+	server.AddTicket(zdlib.Ticket{ID: 2004, Status: "closed"})
+	viper.Set("prune.policies", []map[string]any{
+		{"name": "never", "statuses": []string{"none"}},
+	})
+	viper.Set("prune.mode", pruneActionDeleteAttachments)
+	viper.Set("prune.max-work-dir-size", "2500")
+
+	// each eviction only frees the packet, the notes stay, so all three packets go to fit the cap
+	ids := []int64{zendesktest.FixtureClosedRecentID, zendesktest.FixtureSolvedOldID, 2004}
+	for _, id := range ids {
+		folder := ticketFolder(workDir, id)
+		if err := os.MkdirAll(folder, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"notes.md", "mattermost_support_packet_2023-09-01-10-00.zip"} {
+			if err := os.WriteFile(filepath.Join(folder, name), bytes.Repeat([]byte("x"), 700), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := runCommand(nil, t, "prune", "--yes"); err != nil {
+		t.Fatalf("prune failed: %s", err)
+	}
+
+	for _, id := range ids {
+		folder := ticketFolder(workDir, id)
+		if _, err := os.Stat(filepath.Join(folder, "mattermost_support_packet_2023-09-01-10-00.zip")); !os.IsNotExist(err) {
+			t.Errorf("the packet of ticket %d should be removed to fit the cap", id)
+		}
+		if _, err := os.Stat(filepath.Join(folder, "notes.md")); err != nil {
+			t.Errorf("the notes of ticket %d should be kept: %s", id, err)
+		}
+	}
+}
+
+func TestPruneRejectsUnknownMode(t *testing.T) {
+	_, workDir := setupTest(t)
+	viper.Set("prune.policies", []map[string]any{
+		{"name": "old", "statuses": []string{"solved"}, "action": pruneActionDelete},
+	})
+	viper.Set("prune.mode", "archvie")
+
+	if err := os.MkdirAll(ticketFolder(workDir, zendesktest.FixtureSolvedOldID), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	err := runCommand(nil, t, "prune", "--yes")
+	if err == nil || !strings.Contains(err.Error(), "prune.mode") {
+		t.Fatalf("expected an error about prune.mode, got %v", err)
+	}
+}
+
+func TestPruneOrphans(t *testing.T) {
+	server, workDir := setupTest(t)
+	viper.Set("prune.orphan-action", pruneActionDelete)
+
+	const deletedID = 4242
+	server.Forbidden[zendesktest.FixtureOpenTicketID] = true
+	server.MergeTicket(zendesktest.FixtureClosedRecentID, zendesktest.FixtureSolvedOldID)
+
+	for _, id := range []int64{deletedID, zendesktest.FixtureOpenTicketID, zendesktest.FixtureClosedRecentID} {
+		if err := os.MkdirAll(ticketFolder(workDir, id), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := &bytes.Buffer{}
+	rootCmd.SetOut(out)
+	defer rootCmd.SetOut(nil)
+
+	if err := runCommand(nil, t, "prune", "--yes"); err != nil {
+		t.Fatalf("prune failed: %s", err)
+	}
+
+	for _, id := range []int64{deletedID, zendesktest.FixtureOpenTicketID, zendesktest.FixtureClosedRecentID} {
+		if _, err := os.Stat(ticketFolder(workDir, id)); !os.IsNotExist(err) {
+			t.Errorf("folder of orphan %d should have been removed", id)
+		}
+	}
+
+	orphans := map[string]string{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if fields := strings.Fields(line); len(fields) == 4 {
+			orphans[fields[0]] = fields[1] + " " + fields[2]
+		}
+	}
+	for id, want := range map[int64]string{
+		deletedID:                         "deleted -",
+		zendesktest.FixtureOpenTicketID:   "inaccessible -",
+		zendesktest.FixtureClosedRecentID: "merged " + formatID(zendesktest.FixtureSolvedOldID),
+	} {
+		if got := orphans[formatID(id)]; got != want {
+			t.Errorf("orphan %d should be reported as %q, got %q in:\n%s", id, want, got, out)
+		}
+	}
+}
+
+func TestPruneLaggingTicket(t *testing.T) {
+	server, workDir := setupTest(t)
+	server.Lagging[zendesktest.FixtureSolvedOldID] = true
+
+	for _, id := range []int64{zendesktest.FixtureSolvedOldID, zendesktest.FixtureClosedRecentID} {
+		if err := os.MkdirAll(ticketFolder(workDir, id), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := runCommand(nil, t, "prune", "--yes"); err != nil {
+		t.Fatalf("prune failed: %s", err)
+	}
+
+	// the ticket left out of the batch is fetched on its own and pruned like the others
+	if _, err := os.Stat(ticketFolder(workDir, zendesktest.FixtureSolvedOldID)); !os.IsNotExist(err) {
+		t.Error("folder of the ticket solved 90 days ago should have been removed")
+	}
+	if _, err := os.Stat(ticketFolder(workDir, zendesktest.FixtureClosedRecentID)); err != nil {
+		t.Errorf("folder of the recently closed ticket should have been kept: %s", err)
+	}
+}
+
+func TestPruneSkipsMalformedFolders(t *testing.T) {
+	_, workDir := setupTest(t)
+
+	for _, folder := range []string{filepath.Join(workDir, "ZD-foo"), ticketFolder(workDir, zendesktest.FixtureSolvedOldID)} {
+		if err := os.MkdirAll(folder, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := runCommand(nil, t, "prune", "--yes"); err != nil {
+		t.Fatalf("prune should skip malformed folders, got: %s", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(workDir, "ZD-foo")); err != nil {
+		t.Errorf("malformed folder should be left alone: %s", err)
+	}
+	if _, err := os.Stat(ticketFolder(workDir, zendesktest.FixtureSolvedOldID)); !os.IsNotExist(err) {
+		t.Error("folder of the ticket solved 90 days ago should have been removed")
+	}
+}
+
+func TestPruneSkipsBusyTickets(t *testing.T) {
+	_, workDir := setupTest(t)
+	viper.Set("lock-timeout", "0s")
+
+	folder := ticketFolder(workDir, zendesktest.FixtureSolvedOldID)
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ws, err := workspace.New(workDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock, err := ws.LockTicket(zendesktest.FixtureSolvedOldID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Unlock()
+
+	if err := runCommand(nil, t, "prune", "--yes"); err != nil {
+		t.Fatalf("prune failed: %s", err)
+	}
+	if _, err := os.Stat(folder); err != nil {
+		t.Errorf("busy folder should not have been removed: %s", err)
+	}
+
+	err = runCommand(nil, t, "keep", formatID(zendesktest.FixtureSolvedOldID))
+	if !errors.Is(err, workspace.ErrBusy) || !strings.Contains(err.Error(), "is busy") {
+		t.Errorf("keep should fail with a busy error, got %v", err)
+	}
+}
+
+func TestPruneDryRunWithoutIndexLock(t *testing.T) {
+	_, workDir := setupTest(t)
+	viper.Set("lock-timeout", "0s")
+
+	if err := os.MkdirAll(ticketFolder(workDir, zendesktest.FixtureSolvedOldID), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ws, err := workspace.New(workDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock, err := ws.LockIndex(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Unlock()
+
+	// the report does not need the index, only the pruning does
+	if err := runCommand(nil, t, "prune", "--dry-run"); err != nil {
+		t.Fatalf("prune --dry-run should not wait for the index, got: %s", err)
+	}
+	err = runCommand(nil, t, "prune", "--yes")
+	if !errors.Is(err, workspace.ErrBusy) {
+		t.Errorf("prune should fail with a busy error, got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/julientant/supportctl/archive"
+	"github.com/julientant/supportctl/workspace"
+	"github.com/spf13/cobra"
+)
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:       "restore [ticket number]",
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"ticket number"},
+	Short:     "Restore an archived ticket folder",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ticketNumber := args[0]
+		id, err := workspace.ParseTicketID(ticketNumber)
+		if err != nil {
+			return fmt.Errorf("failed to parse ticket number: %w", err)
+		}
+
+		ws, err := openWorkspace()
+		if err != nil {
+			return err
+		}
+		indexLock, err := lockIndex(ws)
+		if err != nil {
+			return err
+		}
+		defer indexLock.Unlock()
+		lock, err := lockTicket(ws, id)
+		if err != nil {
+			return err
+		}
+		defer lock.Unlock()
+
+		if ticketFolderExists(ticketNumber) {
+			return fmt.Errorf("ticket folder %s already exists", getTicketFolderPath(ticketNumber))
+		}
+
+		dir := archiveDir()
+		idx, err := archive.LoadIndex(dir)
+		if err != nil {
+			return err
+		}
+
+		entry, ok := idx.Latest(id)
+		if !ok {
+			return fmt.Errorf("no archive found for ticket %s in %s", ticketNumber, dir)
+		}
+
+		folder := getTicketFolderPath(ticketNumber)
+		log.Printf("Restoring %s to %s", entry.File, folder)
+		if err := archive.Extract(filepath.Join(dir, entry.File), folder); err != nil {
+			// do not leave a half restored folder behind
+			os.RemoveAll(folder)
+			return fmt.Errorf("failed to restore archive: %w", err)
+		}
+
+		if len(entry.Excluded) > 0 {
+			log.Printf("These files were not archived, run get to download them again: %v", entry.Excluded)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+}
@@ -3,7 +3,9 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/julientant/supportctl/zendesk"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -11,8 +13,9 @@ import (
 var cfgFile string
 
 var rootCmd = &cobra.Command{
-	Use:   "supportctl",
-	Short: "Tooling for mattermost support",
+	Use:               "supportctl",
+	Short:             "Tooling for mattermost support",
+	PersistentPreRunE: applyProfile,
 }
 
 func Execute() {
@@ -27,14 +30,39 @@ func init() {
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.supportctl.yaml)")
 
+	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "log the zendesk requests")
+	viper.BindPFlag("verbose", rootCmd.PersistentFlags().Lookup("verbose"))
+
+	rootCmd.PersistentFlags().String("profile", "", "profile to use from the config file")
+	viper.BindPFlag("profile", rootCmd.PersistentFlags().Lookup("profile"))
+	viper.BindEnv("profile", "SUPPORTCTL_PROFILE")
+
 	rootCmd.PersistentFlags().String("zendesk.subdomain", "", "Zendesk subdomain")
 	viper.BindPFlag("zendesk.subdomain", rootCmd.PersistentFlags().Lookup("zendesk.subdomain"))
 
 	rootCmd.PersistentFlags().String("zendesk.bearer-token", "", "Zendesk bearer token")
 	viper.BindPFlag("zendesk.bearer-token", rootCmd.PersistentFlags().Lookup("zendesk.bearer-token"))
 
+	rootCmd.PersistentFlags().String("zendesk.auth-mode", zendesk.AuthModeOAuth, "Zendesk authentication mode (oauth or api-token)")
+	viper.BindPFlag("zendesk.auth-mode", rootCmd.PersistentFlags().Lookup("zendesk.auth-mode"))
+	viper.BindEnv("zendesk.auth-mode", "SUPPORTCTL_ZENDESK_AUTH_MODE")
+
+	rootCmd.PersistentFlags().String("zendesk.email", "", "Zendesk email, used with the api-token auth mode")
+	viper.BindPFlag("zendesk.email", rootCmd.PersistentFlags().Lookup("zendesk.email"))
+	viper.BindEnv("zendesk.email", "SUPPORTCTL_ZENDESK_EMAIL")
+
+	rootCmd.PersistentFlags().String("zendesk.api-token", "", "Zendesk API token, used with the api-token auth mode")
+	viper.BindPFlag("zendesk.api-token", rootCmd.PersistentFlags().Lookup("zendesk.api-token"))
+	viper.BindEnv("zendesk.api-token", "SUPPORTCTL_ZENDESK_API_TOKEN")
+
 	rootCmd.PersistentFlags().String("work-dir", ".", "location of the work directory for the tickets")
 	viper.BindPFlag("work-dir", rootCmd.PersistentFlags().Lookup("work-dir"))
+
+	rootCmd.PersistentFlags().String("archive-dir", "", "location of the archived ticket folders (default is .archive in the work directory)")
+	viper.BindPFlag("archive-dir", rootCmd.PersistentFlags().Lookup("archive-dir"))
+
+	rootCmd.PersistentFlags().Duration("lock-timeout", 5*time.Second, "how long to wait for another command using the same ticket folder")
+	viper.BindPFlag("lock-timeout", rootCmd.PersistentFlags().Lookup("lock-timeout"))
 }
 
 func initConfig() {
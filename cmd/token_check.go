@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/julientant/supportctl/zendesk"
+	"github.com/spf13/viper"
+)
+
+// how long a token that zendesk accepted is trusted without asking again
+const tokenCheckTTL = time.Hour
+
+var errTokenRejected = errors.New("zendesk rejected the credentials, run `supportctl login` to set new ones")
+
+// tokenCheckCache maps a hash of the subdomain and token to the last time zendesk accepted it
+type tokenCheckCache map[string]time.Time
+
+func tokenCheckCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get cache dir: %w", err)
+	}
+
+	return filepath.Join(dir, "supportctl", "token-check.json"), nil
+}
+
+func tokenCheckKey() string {
+	h := sha256.Sum256([]byte(strings.Join([]string{
+		viper.GetString("zendesk.subdomain"),
+		viper.GetString("zendesk.auth-mode"),
+		viper.GetString("zendesk.bearer-token"),
+		viper.GetString("zendesk.email"),
+		viper.GetString("zendesk.api-token"),
+	}, ":")))
+	return hex.EncodeToString(h[:])
+}
+
+func loadTokenCheckCache(path string) tokenCheckCache {
+	cache := tokenCheckCache{}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+
+	// a corrupted cache only means we check again
+	_ = json.Unmarshal(b, &cache)
+	return cache
+}
+
+func (c tokenCheckCache) save(path string) error {
+	// drop the entries that expired, there is no need to keep them around
+	for key, checkedAt := range c {
+		if time.Since(checkedAt) > tokenCheckTTL {
+			delete(c, key)
+		}
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, b, 0600)
+}
+
+// checkToken makes sure zendesk accepts the configured token, caching the result for tokenCheckTTL.
+// Only a rejected token is an error, other failures are left to the command itself.
+func checkToken(ctx context.Context) error {
+	path, err := tokenCheckCachePath()
+	if err != nil {
+		return err
+	}
+
+	cache := loadTokenCheckCache(path)
+	key := tokenCheckKey()
+	if checkedAt, ok := cache[key]; ok && time.Since(checkedAt) < tokenCheckTTL {
+		return nil
+	}
+
+	zd, err := newZendeskClient()
+	if err != nil {
+		return fmt.Errorf("failed to create zendesk client: %w", err)
+	}
+
+	_, err = zd.GetCurrentUser(ctx)
+	if zendesk.IsUnauthorized(err) {
+		return errTokenRejected
+	}
+	if err != nil {
+		log.Printf("Could not validate the token: %s", err)
+		return nil
+	}
+
+	cache[key] = time.Now()
+	if err := cache.save(path); err != nil {
+		log.Printf("Could not save the token check cache: %s", err)
+	}
+
+	return nil
+}
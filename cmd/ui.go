@@ -0,0 +1,441 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/julientant/supportctl/zendesk"
+	zdlib "github.com/nukosuke/go-zendesk/zendesk"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	uiTabStyle      = lipgloss.NewStyle().Padding(0, 1)
+	uiActiveTab     = uiTabStyle.Copy().Bold(true).Reverse(true)
+	uiSelectedStyle = lipgloss.NewStyle().Reverse(true)
+	uiHeaderStyle   = lipgloss.NewStyle().Bold(true)
+	uiDimStyle      = lipgloss.NewStyle().Faint(true)
+	uiErrorStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+)
+
+const uiHelp = "←/→ view  ↑/↓ ticket  enter comments  g get  o browser  r refresh  q quit"
+
+// uiCmd represents the ui command
+var uiCmd = &cobra.Command{
+	Use:     "ui",
+	Short:   "Show the queue of the watched views in a terminal dashboard",
+	PreRunE: mustHaveZendeskConfig,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		zd, err := newZendeskClient()
+		if err != nil {
+			return fmt.Errorf("failed to create zendesk client: %w", err)
+		}
+
+		// the dashboard shows the views of watch, the notifiers are not used
+		views, err := resolveWatchedViews(cmd.Context(), zd, io.Discard)
+		if err != nil {
+			return err
+		}
+
+		m := newUIModel(cmd.Context(), zd, views)
+		_, err = tea.NewProgram(m, tea.WithAltScreen(), tea.WithContext(cmd.Context())).Run()
+		return err
+	},
+}
+
+// uiQueue is a tab of the dashboard
+type uiQueue struct {
+	view    *watchedView
+	tickets []zdlib.Ticket
+	err     error
+	updated time.Time
+}
+
+type uiModel struct {
+	ctx   context.Context
+	zd    zendesk.API
+	queue []*uiQueue
+
+	current int
+	cursor  int
+	width   int
+	height  int
+	status  string
+
+	// comments of the open ticket, the queue is shown when commentsFor is 0
+	commentsFor int64
+	comments    []zdlib.TicketComment
+	commentsErr error
+	scroll      int
+
+	orgMu    sync.Mutex
+	orgNames map[int64]string
+}
+
+type uiQueueLoadedMsg struct {
+	index   int
+	tickets []zdlib.Ticket
+	err     error
+}
+
+type uiRefreshMsg struct{}
+
+type uiCommentsLoadedMsg struct {
+	ticketID int64
+	comments []zdlib.TicketComment
+	err      error
+}
+
+type uiStatusMsg string
+
+func newUIModel(ctx context.Context, zd zendesk.API, views []*watchedView) *uiModel {
+	m := &uiModel{ctx: ctx, zd: zd, orgNames: map[int64]string{}}
+	for _, v := range views {
+		m.queue = append(m.queue, &uiQueue{view: v})
+	}
+
+	return m
+}
+
+func (m *uiModel) Init() tea.Cmd {
+	return tea.Batch(m.loadAll(), m.scheduleRefresh())
+}
+
+func (m *uiModel) scheduleRefresh() tea.Cmd {
+	return tea.Tick(time.Second*time.Duration(viper.GetInt64("ui.refresh")), func(time.Time) tea.Msg {
+		return uiRefreshMsg{}
+	})
+}
+
+func (m *uiModel) loadAll() tea.Cmd {
+	cmds := []tea.Cmd{}
+	for i := range m.queue {
+		cmds = append(cmds, m.loadQueue(i))
+	}
+
+	return tea.Batch(cmds...)
+}
+
+// loadQueue fetches the tickets of a view, keeping the ones its watch filter matches
+func (m *uiModel) loadQueue(index int) tea.Cmd {
+	v := m.queue[index].view
+	return func() tea.Msg {
+		all, err := viewTickets(m.ctx, m.zd, v.ID)
+		if err != nil {
+			return uiQueueLoadedMsg{index: index, err: err}
+		}
+
+		tickets := []zdlib.Ticket{}
+		for _, ticket := range all {
+			if v.Filter.matches(ticket, m.orgName) {
+				tickets = append(tickets, ticket)
+			}
+		}
+
+		return uiQueueLoadedMsg{index: index, tickets: tickets}
+	}
+}
+
+// orgName is called from the commands loading the views, concurrently
+func (m *uiModel) orgName(id int64) string {
+	m.orgMu.Lock()
+	defer m.orgMu.Unlock()
+
+	if name, ok := m.orgNames[id]; ok {
+		return name
+	}
+	org, _ := m.zd.GetOrganization(m.ctx, id)
+	m.orgNames[id] = org.Name
+
+	return org.Name
+}
+
+func (m *uiModel) loadComments(ticketID int64) tea.Cmd {
+	return func() tea.Msg {
+		comments := []zdlib.TicketComment{}
+		opts := &zdlib.ListTicketCommentsOptions{CursorPagination: zdlib.CursorPagination{PageSize: 100}}
+		for {
+			res, err := m.zd.ListTicketComments(m.ctx, ticketID, opts)
+			if err != nil {
+				return uiCommentsLoadedMsg{ticketID: ticketID, err: err}
+			}
+			comments = append(comments, res.TicketComments...)
+
+			if !res.Meta.HasMore {
+				return uiCommentsLoadedMsg{ticketID: ticketID, comments: comments}
+			}
+			opts.PageAfter = res.Meta.AfterCursor
+		}
+	}
+}
+
+// runGet hands the terminal to `supportctl get` for the ticket
+func (m *uiModel) runGet(ticketID int64) tea.Cmd {
+	args, err := supportctlArgs("get", strconv.FormatInt(ticketID, 10))
+	if err != nil {
+		return func() tea.Msg { return uiStatusMsg(err.Error()) }
+	}
+
+	return tea.ExecProcess(exec.Command(args[0], args[1:]...), func(err error) tea.Msg {
+		if err != nil {
+			return uiStatusMsg(fmt.Sprintf("get %d failed: %s", ticketID, err))
+		}
+		return uiStatusMsg(fmt.Sprintf("Ticket %d is ready in %s", ticketID, getTicketFolderPath(strconv.FormatInt(ticketID, 10))))
+	})
+}
+
+func (m *uiModel) selected() (zdlib.Ticket, bool) {
+	if len(m.queue) == 0 {
+		return zdlib.Ticket{}, false
+	}
+	tickets := m.queue[m.current].tickets
+	if m.cursor < 0 || m.cursor >= len(tickets) {
+		return zdlib.Ticket{}, false
+	}
+
+	return tickets[m.cursor], true
+}
+
+func (m *uiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+	case uiQueueLoadedMsg:
+		q := m.queue[msg.index]
+		q.err = msg.err
+		if msg.err == nil {
+			q.tickets = msg.tickets
+			q.updated = time.Now()
+		}
+		if msg.index == m.current && m.cursor >= len(q.tickets) {
+			m.cursor = max(len(q.tickets)-1, 0)
+		}
+	case uiRefreshMsg:
+		return m, tea.Batch(m.loadAll(), m.scheduleRefresh())
+	case uiCommentsLoadedMsg:
+		if msg.ticketID == m.commentsFor {
+			m.comments, m.commentsErr = msg.comments, msg.err
+		}
+	case uiStatusMsg:
+		m.status = string(msg)
+	case tea.KeyMsg:
+		return m, m.handleKey(msg)
+	}
+
+	return m, nil
+}
+
+func (m *uiModel) handleKey(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "q", "ctrl+c":
+		return tea.Quit
+	}
+
+	if m.commentsFor != 0 {
+		switch msg.String() {
+		case "esc", "backspace", "left", "h":
+			m.commentsFor, m.comments, m.commentsErr = 0, nil, nil
+		case "up", "k":
+			m.scroll = max(m.scroll-1, 0)
+		case "down", "j":
+			m.scroll++
+		case "o":
+			return m.openInBrowser(m.commentsFor)
+		case "g":
+			return m.runGet(m.commentsFor)
+		}
+		return nil
+	}
+
+	switch msg.String() {
+	case "left", "h", "shift+tab":
+		if len(m.queue) > 0 {
+			m.current = (m.current + len(m.queue) - 1) % len(m.queue)
+			m.cursor = 0
+		}
+	case "right", "l", "tab":
+		if len(m.queue) > 0 {
+			m.current = (m.current + 1) % len(m.queue)
+			m.cursor = 0
+		}
+	case "up", "k":
+		m.cursor = max(m.cursor-1, 0)
+	case "down", "j":
+		if len(m.queue) > 0 && m.cursor < len(m.queue[m.current].tickets)-1 {
+			m.cursor++
+		}
+	case "r":
+		m.status = "Refreshing"
+		return m.loadAll()
+	case "enter":
+		if ticket, ok := m.selected(); ok {
+			m.commentsFor, m.comments, m.commentsErr, m.scroll = ticket.ID, nil, nil, 0
+			return m.loadComments(ticket.ID)
+		}
+	case "g":
+		if ticket, ok := m.selected(); ok {
+			return m.runGet(ticket.ID)
+		}
+	case "o":
+		if ticket, ok := m.selected(); ok {
+			return m.openInBrowser(ticket.ID)
+		}
+	}
+
+	return nil
+}
+
+func (m *uiModel) openInBrowser(ticketID int64) tea.Cmd {
+	return func() tea.Msg {
+		if err := openBrowser(ticketURL(ticketID)); err != nil {
+			return uiStatusMsg(fmt.Sprintf("Failed to open the browser: %s", err))
+		}
+		return uiStatusMsg(fmt.Sprintf("Opened ticket %d in the browser", ticketID))
+	}
+}
+
+func (m *uiModel) View() string {
+	var b strings.Builder
+	if m.commentsFor != 0 {
+		m.renderComments(&b)
+	} else {
+		m.renderQueue(&b)
+	}
+
+	footer := uiDimStyle.Render(uiHelp)
+	if m.status != "" {
+		footer = m.status + "\n" + footer
+	}
+
+	// keep the footer at the bottom of the screen
+	body := b.String()
+	if pad := m.height - lipgloss.Height(body) - lipgloss.Height(footer); pad > 0 {
+		body += strings.Repeat("\n", pad)
+	}
+
+	return body + "\n" + footer
+}
+
+func (m *uiModel) renderQueue(b *strings.Builder) {
+	tabs := []string{}
+	for i, q := range m.queue {
+		label := fmt.Sprintf("%s (%d)", q.view.Name, len(q.tickets))
+		if i == m.current {
+			tabs = append(tabs, uiActiveTab.Render(label))
+		} else {
+			tabs = append(tabs, uiTabStyle.Render(label))
+		}
+	}
+	b.WriteString(lipgloss.JoinHorizontal(lipgloss.Top, tabs...) + "\n\n")
+
+	if len(m.queue) == 0 {
+		return
+	}
+	q := m.queue[m.current]
+	if q.err != nil {
+		b.WriteString(uiErrorStyle.Render("Failed to load the view: "+q.err.Error()) + "\n")
+	}
+	if q.updated.IsZero() {
+		b.WriteString("Loading…\n")
+		return
+	}
+
+	line := lipgloss.NewStyle().MaxWidth(max(m.width, 40))
+	b.WriteString(uiHeaderStyle.Render(line.Render(fmt.Sprintf("%-10s %-8s %-8s %-10s %s", "TICKET", "STATUS", "PRIORITY", "UPDATED", "SUBJECT"))) + "\n")
+
+	// scroll the list so the selected ticket stays visible
+	rows := max(m.height-8, 1)
+	start := max(m.cursor-rows+1, 0)
+	for i := start; i < len(q.tickets) && i < start+rows; i++ {
+		t := q.tickets[i]
+		updated := "-"
+		if t.UpdatedAt != nil {
+			updated = t.UpdatedAt.Local().Format("2006-01-02")
+		}
+		row := line.Render(fmt.Sprintf("%-10d %-8s %-8s %-10s %s", t.ID, orDash(t.Status), orDash(t.Priority), updated, t.Subject))
+		if i == m.cursor {
+			row = uiSelectedStyle.Render(row)
+		}
+		b.WriteString(row + "\n")
+	}
+
+	b.WriteString(uiDimStyle.Render(fmt.Sprintf("\nUpdated %s", q.updated.Format("15:04:05"))))
+}
+
+func (m *uiModel) renderComments(b *strings.Builder) {
+	title := fmt.Sprintf("Ticket #%d", m.commentsFor)
+	for _, q := range m.queue {
+		for _, t := range q.tickets {
+			if t.ID == m.commentsFor {
+				title += " " + t.Subject
+			}
+		}
+	}
+	b.WriteString(uiHeaderStyle.Render(title) + "\n\n")
+
+	if m.commentsErr != nil {
+		b.WriteString(uiErrorStyle.Render("Failed to load the comments: "+m.commentsErr.Error()) + "\n")
+		return
+	}
+	if m.comments == nil {
+		b.WriteString("Loading…\n")
+		return
+	}
+
+	wrap := lipgloss.NewStyle().Width(max(m.width-2, 20))
+	lines := []string{}
+	for _, c := range m.comments {
+		header := fmt.Sprintf("— author %d", c.AuthorID)
+		if !c.CreatedAt.IsZero() {
+			header += ", " + c.CreatedAt.Local().Format("2006-01-02 15:04")
+		}
+		if c.Public != nil && !*c.Public {
+			header += " (internal note)"
+		}
+		lines = append(lines, uiDimStyle.Render(header))
+
+		body := c.PlainBody
+		if body == "" {
+			body = c.Body
+		}
+		lines = append(lines, strings.Split(wrap.Render(body), "\n")...)
+		lines = append(lines, "")
+	}
+
+	rows := max(m.height-6, 1)
+	m.scroll = min(m.scroll, max(len(lines)-rows, 0))
+	end := min(m.scroll+rows, len(lines))
+	b.WriteString(strings.Join(lines[m.scroll:end], "\n"))
+}
+
+// openBrowser opens the url with the default browser of the desktop
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+
+	return cmd.Start()
+}
+
+func init() {
+	rootCmd.AddCommand(uiCmd)
+
+	uiCmd.Flags().Int64("ui.refresh", 60, "Seconds between two refreshes of the views")
+	viper.BindPFlag("ui.refresh", uiCmd.Flags().Lookup("ui.refresh"))
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/julientant/supportctl/zendesk/zendesktest"
+	zdlib "github.com/nukosuke/go-zendesk/zendesk"
+	"github.com/spf13/viper"
+)
+
+// runUICmd runs the command returned by the model and feeds its message back
+func runUICmd(t *testing.T, m *uiModel, cmd tea.Cmd) {
+	t.Helper()
+
+	if cmd == nil {
+		return
+	}
+	switch msg := cmd().(type) {
+	case tea.BatchMsg:
+		for _, c := range msg {
+			runUICmd(t, m, c)
+		}
+	case uiRefreshMsg:
+		// the refresh tick is not waited for
+	default:
+		m.Update(msg)
+	}
+}
+
+func TestUIModel(t *testing.T) {
+	server, _ := setupTest(t)
+	server.AddTicket(zdlib.Ticket{ID: 1004, Subject: "Slow search", Status: "new"})
+	server.AddView(zdlib.View{ID: 501, Title: "Enterprise", Active: true}, zendesktest.FixtureOpenTicketID, 1004)
+	viper.Set("watch.views", []map[string]any{
+		{"name": zendesktest.FixtureViewTitle},
+		{"name": "Enterprise", "filter": map[string]any{"statuses": []string{"new"}}},
+	})
+
+	zd, err := newZendeskClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	views, err := resolveWatchedViews(context.Background(), zd, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := newUIModel(context.Background(), zd, views)
+	m.Update(tea.WindowSizeMsg{Width: 120, Height: 40})
+	for i := range m.queue {
+		runUICmd(t, m, m.loadQueue(i))
+	}
+
+	if ticket, ok := m.selected(); !ok || ticket.ID != zendesktest.FixtureOpenTicketID {
+		t.Fatalf("expected ticket %d to be selected, got %d", zendesktest.FixtureOpenTicketID, ticket.ID)
+	}
+	if view := m.View(); !strings.Contains(view, "Server crashes on startup") {
+		t.Fatalf("the first view should list the open ticket:\n%s", view)
+	}
+
+	// the filter of the second view keeps the new ticket only
+	runUICmd(t, m, m.handleKey(tea.KeyMsg{Type: tea.KeyTab}))
+	if got := len(m.queue[m.current].tickets); got != 1 {
+		t.Fatalf("expected 1 ticket in the filtered view, got %d", got)
+	}
+	runUICmd(t, m, m.handleKey(tea.KeyMsg{Type: tea.KeyDown}))
+	if ticket, _ := m.selected(); ticket.ID != 1004 {
+		t.Fatalf("the cursor should stay on the last ticket, got %d", ticket.ID)
+	}
+
+	// back to the first view and open the comments of the ticket
+	runUICmd(t, m, m.handleKey(tea.KeyMsg{Type: tea.KeyLeft}))
+	runUICmd(t, m, m.handleKey(tea.KeyMsg{Type: tea.KeyEnter}))
+	if m.commentsFor != zendesktest.FixtureOpenTicketID {
+		t.Fatalf("expected the comments of ticket %d, got %d", zendesktest.FixtureOpenTicketID, m.commentsFor)
+	}
+	if want := 2 * server.PageSize; len(m.comments) < want {
+		t.Fatalf("expected the comments of every page, got %d", len(m.comments))
+	}
+	if view := m.View(); !strings.Contains(view, "comment 0") {
+		t.Fatalf("the comments should be shown:\n%s", view)
+	}
+
+	runUICmd(t, m, m.handleKey(tea.KeyMsg{Type: tea.KeyEsc}))
+	if m.commentsFor != 0 {
+		t.Fatal("esc should go back to the queue")
+	}
+}
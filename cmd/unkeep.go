@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/julientant/supportctl/workspace"
+	"github.com/spf13/cobra"
+)
+
+// unkeepCmd represents the unkeep command
+var unkeepCmd = &cobra.Command{
+	Use:       "unkeep [ticket number]",
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"ticket number"},
+	Short:     "Let prune remove this ticket folder again",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ticketNumber := args[0]
+		id, err := workspace.ParseTicketID(ticketNumber)
+		if err != nil {
+			return err
+		}
+
+		ws, err := openWorkspace()
+		if err != nil {
+			return err
+		}
+		lock, err := lockTicket(ws, id)
+		if err != nil {
+			return err
+		}
+		defer lock.Unlock()
+
+		folder := ws.TicketPath(id)
+		k, err := workspace.ReadKeep(folder)
+		if err != nil {
+			return err
+		}
+		if k == nil {
+			return fmt.Errorf("ticket %s is not kept", ticketNumber)
+		}
+
+		if err := workspace.RemoveKeep(folder); err != nil {
+			return fmt.Errorf("failed to remove keep file: %w", err)
+		}
+
+		log.Printf("Ticket %s is no longer kept", ticketNumber)
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(unkeepCmd)
+}
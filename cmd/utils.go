@@ -2,13 +2,21 @@ package cmd
 
 import (
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 
+	"github.com/julientant/supportctl/workspace"
+	"github.com/julientant/supportctl/zendesk"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
+// newZendeskClient creates the client used by the commands, tests swap it for one talking to a fake server
+var newZendeskClient = func() (zendesk.API, error) {
+	return zendesk.NewClientFromViper(viper.GetViper())
+}
+
 func ensureWorkingDir() (string, error) {
 	workDir := viper.GetString("work-dir")
 	info, err := os.Stat(workDir)
@@ -28,8 +36,43 @@ func ensureWorkingDir() (string, error) {
 	return workDir, nil
 }
 
+// openWorkspace returns the workspace of the work dir, creating the work dir if needed
+func openWorkspace() (workspace.Workspace, error) {
+	workDir, err := ensureWorkingDir()
+	if err != nil {
+		return workspace.Workspace{}, fmt.Errorf("failed to ensure working dir: %w", err)
+	}
+
+	return workspace.New(workDir)
+}
+
+// scanWorkspace lists the ticket folders of the workspace, logging and skipping the malformed ones
+func scanWorkspace(ws workspace.Workspace) ([]workspace.Folder, error) {
+	folders, malformed, err := ws.Scan()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range malformed {
+		log.Printf("Skipping %s: %s", m.Path, m.Reason)
+	}
+
+	return folders, nil
+}
+
+// lockTicket locks the folder of the ticket against the other supportctl commands,
+// waiting up to lock-timeout for them to release it
+func lockTicket(ws workspace.Workspace, id int64) (*workspace.Lock, error) {
+	return ws.LockTicket(id, viper.GetDuration("lock-timeout"))
+}
+
+// lockIndex locks the state shared by all the ticket folders, like the archive index
+func lockIndex(ws workspace.Workspace) (*workspace.Lock, error) {
+	return ws.LockIndex(viper.GetDuration("lock-timeout"))
+}
+
 func getTicketFolderPath(ticketNumber string) string {
-	folderPath := filepath.Join(viper.GetString("work-dir"), "ZD-"+ticketNumber)
+	folderPath := filepath.Join(viper.GetString("work-dir"), workspace.FolderPrefix+ticketNumber)
 	path, err := filepath.Abs(folderPath)
 	if err != nil {
 		panic(fmt.Errorf("failed to get absolute path: %w", err))
@@ -48,33 +91,54 @@ func ticketFolderExists(ticketNumber string) bool {
 	return info.IsDir()
 }
 
-func makeTicketFolderIfNeeded(ticketNumber string) (string, error) {
-	_, err := ensureWorkingDir()
+// ticketURL returns the agent page of the ticket
+func ticketURL(id int64) string {
+	return fmt.Sprintf("https://%s.zendesk.com/agent/tickets/%d", viper.GetString("zendesk.subdomain"), id)
+}
+
+// supportctlArgs returns the command line running supportctl with args,
+// with the config file and profile of the current run
+func supportctlArgs(args ...string) ([]string, error) {
+	exe, err := os.Executable()
 	if err != nil {
-		return "", fmt.Errorf("failed to ensure working dir: %w", err)
+		return nil, fmt.Errorf("failed to find the supportctl executable: %w", err)
 	}
 
-	folderPath := getTicketFolderPath(ticketNumber)
-	if err = os.MkdirAll(folderPath, 0755); err != nil {
-		return "", fmt.Errorf("failed to create folder: %w", err)
+	cmdline := append([]string{exe}, args...)
+	if cfgFile != "" {
+		abs, err := filepath.Abs(cfgFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get absolute path: %w", err)
+		}
+		cmdline = append(cmdline, "--config", abs)
 	}
-
-	path, err := filepath.Abs(folderPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to get absolute path: %w", err)
+	if profile := activeProfile(); profile != "" {
+		cmdline = append(cmdline, "--profile", profile)
 	}
 
-	return path, nil
+	return cmdline, nil
 }
 
-func mustHaveZendeskConfig(_ *cobra.Command, _ []string) error {
+func mustHaveZendeskConfig(cmd *cobra.Command, _ []string) error {
 	if viper.GetString("zendesk.subdomain") == "" {
 		return fmt.Errorf("zendesk.subdomain is not set")
 	}
 
-	if viper.GetString("zendesk.bearer-token") == "" {
-		return fmt.Errorf("zendesk.bearer-token is not set")
+	switch mode := viper.GetString("zendesk.auth-mode"); mode {
+	case "", zendesk.AuthModeOAuth:
+		if viper.GetString("zendesk.bearer-token") == "" {
+			return fmt.Errorf("zendesk.bearer-token is not set")
+		}
+	case zendesk.AuthModeAPIToken:
+		if viper.GetString("zendesk.email") == "" {
+			return fmt.Errorf("zendesk.email is not set")
+		}
+		if viper.GetString("zendesk.api-token") == "" {
+			return fmt.Errorf("zendesk.api-token is not set")
+		}
+	default:
+		return fmt.Errorf("zendesk.auth-mode must be %s or %s, got %q", zendesk.AuthModeOAuth, zendesk.AuthModeAPIToken, mode)
 	}
 
-	return nil
+	return checkToken(cmd.Context())
 }
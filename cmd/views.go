@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// viewsCmd represents the views command
+var viewsCmd = &cobra.Command{
+	Use:   "views",
+	Short: "Zendesk views",
+}
+
+// viewsListCmd represents the views list command
+var viewsListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "List the views that can be watched",
+	PreRunE: mustHaveZendeskConfig,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		zd, err := newZendeskClient()
+		if err != nil {
+			return fmt.Errorf("failed to create zendesk client: %w", err)
+		}
+
+		views, err := zd.GetAllViews(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to get views: %w", err)
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tACTIVE\tNAME")
+		for _, v := range views {
+			fmt.Fprintf(w, "%d\t%s\t%s\n", v.ID, yesNo(v.Active), v.Title)
+		}
+
+		return w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(viewsCmd)
+	viewsCmd.AddCommand(viewsListCmd)
+}
@@ -1,95 +1,397 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gen2brain/beeep"
+	"github.com/julientant/supportctl/notify"
 	"github.com/julientant/supportctl/zendesk"
 	zdlib "github.com/nukosuke/go-zendesk/zendesk"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
+// sendAlert and sendQuietAlert show desktop notifications, with and without sound.
+// Tests replace them to capture notifications.
+var (
+	sendAlert      = beeep.Alert
+	sendQuietAlert = beeep.Notify
+)
+
+// watcher polls a view and notifies the tickets it has not seen yet,
+// what it saw is persisted so restarts do not notify again
+type watcher struct {
+	zd        zendesk.API
+	state     *watchState
+	statePath string
+	orgNames  map[int64]string
+	// me is the zendesk user running the watcher, set when the watch mode or watch.prepare.assigned need it
+	me int64
+
+	preparer        *ticketPreparer
+	prepareAssigned bool
+
+	// scheduled are the notifiers following watch.schedule, by name
+	scheduled map[string]*notify.Scheduled
+
+	// mu guards the poll results of the views, read by the daemon status API
+	mu        sync.Mutex
+	views     []*watchedView
+	startedAt time.Time
+}
+
 // watchCmd represents the ui command
 var watchCmd = &cobra.Command{
-	Use:   "watch",
-	Short: "Start a view watcher",
+	Use:     "watch",
+	Short:   "Start a view watcher",
+	PreRunE: mustHaveZendeskConfig,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		zd, err := zendesk.NewClientFromViper(viper.GetViper())
+		daemon, _ := cmd.Flags().GetBool("daemon")
+		if daemon {
+			restore, err := setupDaemonLogging(cmd.ErrOrStderr())
+			if err != nil {
+				return err
+			}
+			defer restore()
+		}
+
+		zd, err := newZendeskClient()
 		if err != nil {
 			return fmt.Errorf("failed to create zendesk client: %w", err)
 		}
 
-		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, os.Kill)
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
 		defer stop()
 
-		var viewID int64
-		viewName := viper.GetString("watch.view")
-		views, _, err := zd.GetViews(ctx)
+		statePath, err := watchStatePath()
 		if err != nil {
-			return fmt.Errorf("failed to get views: %w", err)
+			return err
 		}
-		for _, v := range views {
-			if v.Title == viewName {
-				viewID = v.ID
-				break
+		state, err := loadWatchState(statePath)
+		if err != nil {
+			return err
+		}
+		w := &watcher{
+			zd:        zd,
+			state:     state,
+			statePath: statePath,
+			orgNames:  map[int64]string{},
+			startedAt: time.Now(),
+		}
+
+		views, err := resolveWatchedViews(ctx, zd, cmd.OutOrStdout())
+		// the daemon waits for zendesk to be reachable, a wrong config still stops it
+		for failures := 1; daemon && errors.Is(err, errViewsUnavailable); failures++ {
+			delay := pollBackoff(failures)
+			slog.Error("Failed to resolve the watched views", "error", err, "retry_in", delay)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return nil
 			}
+			views, err = resolveWatchedViews(ctx, zd, cmd.OutOrStdout())
+		}
+		if err != nil {
+			return err
+		}
+		w.views = views
+		w.scheduled = scheduledNotifiers(views)
+		for name, s := range w.scheduled {
+			s.Hold(state.Held[name]...)
 		}
 
-		ticket := time.NewTicker(time.Minute * time.Duration(viper.GetInt64("watch.frequency")))
-		for {
-			pageOptions := zdlib.PageOptions{PerPage: 100, Page: 1}
-			allTickets := []zdlib.Ticket{}
-			for {
-				tickets, page, err := zd.GetTicketsFromView(ctx, viewID, &zdlib.TicketListOptions{
-					PageOptions: pageOptions,
-				})
+		w.prepareAssigned = viper.GetBool("watch.prepare.assigned")
+		if w.prepareAssigned {
+			if _, err := w.currentUserID(ctx); err != nil {
+				return err
+			}
+		}
+		for _, v := range views {
+			if w.prepareAssigned || v.Prepare {
+				ws, err := openWorkspace()
 				if err != nil {
-					return fmt.Errorf("failed to search tickets: %w", err)
+					return err
 				}
+				w.preparer = newTicketPreparer(zd, ws)
+				defer w.preparer.wait()
+				break
+			}
+		}
 
-				for _, ticket := range tickets {
-					allTickets = append(allTickets, ticket)
-				}
+		var feed *exportFeed
+		switch mode := viper.GetString("watch.mode"); mode {
+		case watchModeView:
+		case watchModeExport:
+			if feed, err = w.setupExport(ctx, views); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown watch mode %q, it must be %s or %s", mode, watchModeView, watchModeExport)
+		}
+
+		if daemon {
+			socket, err := watchSocketPath()
+			if err != nil {
+				return err
+			}
+			if err := w.serveStatus(ctx, socket); err != nil {
+				return err
+			}
+			slog.Info("Watcher started", "views", len(views), "socket", socket)
+		}
 
-				if page.HasNext() {
-					pageOptions.Page++
-				} else {
-					break
+		for {
+			now := time.Now()
+			next := now.Add(24 * time.Hour)
+			if len(w.scheduled) > 0 {
+				// the shift can start between two polls
+				w.flushDigests(ctx)
+				next = now.Add(time.Minute)
+			}
+			if feed != nil {
+				if !now.Before(feed.next) {
+					err := w.pollExport(ctx, feed, now)
+					if err != nil {
+						feed.failures++
+						feed.next = now.Add(pollBackoff(feed.failures))
+						for _, v := range feed.views {
+							if !v.lastPoll.Equal(now) {
+								w.record(v, now, nil, err)
+							}
+						}
+						if !daemon {
+							return err
+						}
+						slog.Error("Failed to follow the ticket export", "error", err, "failures", feed.failures, "retry_at", feed.next)
+					} else {
+						feed.failures = 0
+						feed.next = now.Add(time.Minute * time.Duration(viper.GetInt64("watch.frequency")))
+					}
+				}
+				if feed.next.Before(next) {
+					next = feed.next
 				}
 			}
 
-			if len(allTickets) > 0 {
-				if err := beeep.Alert("SupportCTL", fmt.Sprintf("You have %d tickets in the queue", len(allTickets)), "assets/information.png"); err != nil {
-					return fmt.Errorf("failed to send notification: %w", err)
+			for _, v := range views {
+				if v.match != nil {
+					// followed by the export feed
+					continue
+				}
+				if !now.Before(v.next) {
+					tickets, err := w.poll(ctx, v)
+					w.record(v, now, tickets, err)
+					if err != nil {
+						if !daemon {
+							return err
+						}
+						slog.Error("Failed to poll view", "view", v.Name, "error", err, "failures", v.failures, "retry_at", v.next)
+					}
+				}
+				if v.next.Before(next) {
+					next = v.next
 				}
 			}
 
+			timer := time.NewTimer(time.Until(next))
 			select {
-			case <-ticket.C:
+			case <-timer.C:
 				continue
 			case <-ctx.Done():
+				timer.Stop()
 				log.Println("Stopping watcher")
 				return nil
 			}
+		}
+	},
+}
+
+// poll fetches the tickets of the view and processes them
+func (w *watcher) poll(ctx context.Context, v *watchedView) ([]zdlib.Ticket, error) {
+	all, err := viewTickets(ctx, w.zd, v.ID)
+	if err != nil {
+		return nil, err
+	}
 
+	return w.process(ctx, v, all)
+}
+
+// process notifies the tickets that arrived in the view since the last poll,
+// and the ones left unassigned for longer than watch.renotify-unassigned-after
+func (w *watcher) process(ctx context.Context, v *watchedView, all []zdlib.Ticket) ([]zdlib.Ticket, error) {
+	// tickets the filter leaves out are not tracked, they are new if they match later
+	tickets := []zdlib.Ticket{}
+	for _, ticket := range all {
+		if v.Filter.matches(ticket, func(id int64) string { return w.orgName(ctx, id) }) {
+			tickets = append(tickets, ticket)
 		}
+	}
 
-		return nil
-	},
+	renotifyAfter := time.Minute * time.Duration(viper.GetInt64("watch.renotify-unassigned-after"))
+	now := time.Now()
+	seen := w.state.view(watchStateKey(v.ID))
+	inView := map[int64]bool{}
+	// a failed notification is retried on the next poll, the ones sent are saved so they are not sent again
+	errs := []error{}
+	for _, ticket := range tickets {
+		inView[ticket.ID] = true
+
+		s, ok := seen[ticket.ID]
+		switch {
+		case !ok:
+			s = &seenTicket{FirstSeen: now}
+			if err := w.notify(ctx, v, notify.KindNew, ticket, s); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			s.LastNotified = now
+			seen[ticket.ID] = s
+		case renotifyAfter > 0 && ticket.AssigneeID == 0 && now.Sub(s.LastNotified) >= renotifyAfter:
+			if err := w.notify(ctx, v, notify.KindUnassigned, ticket, s); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			s.LastNotified = now
+		}
+	}
+
+	w.prepareTickets(ctx, v, tickets)
+
+	if err := w.checkSLAs(ctx, v, tickets, seen); err != nil {
+		errs = append(errs, err)
+	}
+
+	// tickets that left the view are notified again if they come back
+	for id := range seen {
+		if !inView[id] {
+			delete(seen, id)
+		}
+	}
+
+	w.syncHeld()
+	if err := w.state.save(w.statePath); err != nil {
+		errs = append(errs, fmt.Errorf("failed to save watch state: %w", err))
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return tickets, nil
+}
+
+// viewTickets returns all the tickets of a view, going through its pages
+func viewTickets(ctx context.Context, zd zendesk.API, viewID int64) ([]zdlib.Ticket, error) {
+	pageOptions := zdlib.PageOptions{PerPage: 100, Page: 1}
+	allTickets := []zdlib.Ticket{}
+	for {
+		tickets, page, err := zd.GetTicketsFromView(ctx, viewID, &zdlib.TicketListOptions{
+			PageOptions: pageOptions,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to search tickets: %w", err)
+		}
+
+		allTickets = append(allTickets, tickets...)
+
+		if !page.HasNext() {
+			return allTickets, nil
+		}
+		pageOptions.Page++
+	}
+}
+
+// notify sends a notification for the ticket through the notifier of the view
+func (w *watcher) notify(ctx context.Context, v *watchedView, kind string, ticket zdlib.Ticket, s *seenTicket) error {
+	if err := v.notifier.Notify(ctx, w.event(ctx, v, kind, ticket, s)); err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+
+	return nil
+}
+
+func (w *watcher) event(ctx context.Context, v *watchedView, kind string, ticket zdlib.Ticket, s *seenTicket) notify.Event {
+	return notify.Event{
+		Kind:         kind,
+		View:         v.Name,
+		Ticket:       ticket,
+		Organization: w.orgName(ctx, ticket.OrganizationID),
+		URL:          ticketURL(ticket.ID),
+		FirstSeen:    s.FirstSeen,
+		Urgency:      notify.UrgencyNormal,
+	}
+}
+
+// currentUserID returns the id of the zendesk user running the watcher
+func (w *watcher) currentUserID(ctx context.Context) (int64, error) {
+	if w.me == 0 {
+		me, err := w.zd.GetCurrentUser(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get current user: %w", err)
+		}
+		w.me = me.ID
+	}
+
+	return w.me, nil
+}
+
+func (w *watcher) orgName(ctx context.Context, id int64) string {
+	if id == 0 {
+		return ""
+	}
+	if name, ok := w.orgNames[id]; ok {
+		return name
+	}
+
+	org, err := w.zd.GetOrganization(ctx, id)
+	if err != nil {
+		log.Printf("Failed to retrieve organization %d: %s", id, err)
+	}
+	w.orgNames[id] = org.Name
+
+	return org.Name
 }
 
 func init() {
 	rootCmd.AddCommand(watchCmd)
 
-	watchCmd.Flags().String("watch.view", "Support - New & Unassigned", "View to watch")
+	watchCmd.Flags().String("watch.view", "Support - New & Unassigned", "View to watch when watch.views is not set")
 	viper.BindPFlag("watch.view", watchCmd.Flags().Lookup("watch.view"))
 
-	watchCmd.Flags().Int64("watch.frequency", 1, "Frequency in minutes")
+	watchCmd.Flags().Int64("watch.frequency", 1, "Frequency in minutes of the views without their own")
 	viper.BindPFlag("watch.frequency", watchCmd.Flags().Lookup("watch.frequency"))
 
+	watchCmd.Flags().Int64("watch.renotify-unassigned-after", 0, "Notify again about tickets still unassigned after this many minutes, 0 to never")
+	viper.BindPFlag("watch.renotify-unassigned-after", watchCmd.Flags().Lookup("watch.renotify-unassigned-after"))
+
+	watchCmd.Flags().Int64("watch.sla-warning", 0, "Notify tickets this many minutes before they breach their first or next reply SLA, 0 to never")
+	viper.BindPFlag("watch.sla-warning", watchCmd.Flags().Lookup("watch.sla-warning"))
+
+	watchCmd.Flags().String("watch.mode", watchModeView, "How the views are followed: view fetches all their tickets on each poll, export reads the changed tickets from the incremental export")
+	viper.BindPFlag("watch.mode", watchCmd.Flags().Lookup("watch.mode"))
+
+	watchCmd.Flags().Int64("watch.export.resync", 60, "In export mode, minutes between two full fetches of the views, 0 to only fetch them at start")
+	viper.BindPFlag("watch.export.resync", watchCmd.Flags().Lookup("watch.export.resync"))
+
+	watchCmd.Flags().Bool("watch.prepare.assigned", false, "Run get in the background for the watched tickets assigned to you")
+	viper.BindPFlag("watch.prepare.assigned", watchCmd.Flags().Lookup("watch.prepare.assigned"))
+
+	watchCmd.Flags().Int("watch.prepare.concurrency", 2, "Number of tickets prepared at the same time")
+	viper.BindPFlag("watch.prepare.concurrency", watchCmd.Flags().Lookup("watch.prepare.concurrency"))
+
+	watchCmd.Flags().Bool("daemon", false, "keep watching through zendesk errors, with structured logs and a status API on a unix socket")
+
+	watchCmd.Flags().String("watch.log-format", "json", "Format of the daemon logs, json or text")
+	viper.BindPFlag("watch.log-format", watchCmd.Flags().Lookup("watch.log-format"))
+
+	watchCmd.Flags().String("watch.socket", "", "Unix socket of the daemon status API (default is watch.sock in the state dir)")
+	viper.BindPFlag("watch.socket", watchCmd.Flags().Lookup("watch.socket"))
 }
@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	zdlib "github.com/nukosuke/go-zendesk/zendesk"
+	"github.com/spf13/viper"
+)
+
+// the daemon retries a failing view after 30s, doubling up to 15 minutes
+const (
+	pollBackoffMin = 30 * time.Second
+	pollBackoffMax = 15 * time.Minute
+)
+
+// watchQueueTicket is a ticket of a watched view as shown by the status API
+type watchQueueTicket struct {
+	ID           int64     `json:"id"`
+	Subject      string    `json:"subject"`
+	Status       string    `json:"status"`
+	Priority     string    `json:"priority,omitempty"`
+	AssigneeID   int64     `json:"assignee_id,omitempty"`
+	Organization string    `json:"organization,omitempty"`
+	FirstSeen    time.Time `json:"first_seen"`
+}
+
+// watchViewStatus is the last poll of a watched view as shown by the status API
+type watchViewStatus struct {
+	Name      string             `json:"name"`
+	ID        int64              `json:"id"`
+	LastPoll  *time.Time         `json:"last_poll,omitempty"`
+	LastError string             `json:"last_error,omitempty"`
+	Failures  int                `json:"failures"`
+	NextPoll  time.Time          `json:"next_poll"`
+	Queue     []watchQueueTicket `json:"queue"`
+}
+
+type watchStatusResponse struct {
+	StartedAt time.Time         `json:"started_at"`
+	Views     []watchViewStatus `json:"views"`
+}
+
+// setupDaemonLogging sends the logs, including the log package ones, through slog
+// and returns a function putting the previous logger back
+func setupDaemonLogging(out io.Writer) (func(), error) {
+	var handler slog.Handler
+	switch format := viper.GetString("watch.log-format"); format {
+	case "json":
+		handler = slog.NewJSONHandler(out, nil)
+	case "text":
+		handler = slog.NewTextHandler(out, nil)
+	default:
+		return nil, fmt.Errorf("unknown watch.log-format %q, must be json or text", format)
+	}
+
+	previous := slog.Default()
+	slog.SetDefault(slog.New(handler))
+
+	return func() { slog.SetDefault(previous) }, nil
+}
+
+// pollBackoff returns how long to wait before polling again after the given number of consecutive failures
+func pollBackoff(failures int) time.Duration {
+	delay := pollBackoffMin
+	for i := 1; i < failures && delay < pollBackoffMax; i++ {
+		delay *= 2
+	}
+
+	return min(delay, pollBackoffMax)
+}
+
+func watchSocketPath() (string, error) {
+	if path := viper.GetString("watch.socket"); path != "" {
+		return path, nil
+	}
+
+	dir, err := userStateDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get state dir: %w", err)
+	}
+
+	// one daemon can run per profile
+	name := "watch.sock"
+	if profile := activeProfile(); profile != "" {
+		name = "watch-" + profile + ".sock"
+	}
+
+	return filepath.Join(dir, "supportctl", name), nil
+}
+
+// record keeps the result of a poll for the status API and schedules the next one
+func (w *watcher) record(v *watchedView, at time.Time, tickets []zdlib.Ticket, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	v.lastPoll = at
+	v.lastErr = err
+	if err != nil {
+		v.failures++
+		v.next = at.Add(pollBackoff(v.failures))
+		return
+	}
+
+	v.failures = 0
+	v.next = at.Add(v.frequency())
+
+	seen := w.state.view(watchStateKey(v.ID))
+	v.queue = make([]watchQueueTicket, 0, len(tickets))
+	for _, ticket := range tickets {
+		q := watchQueueTicket{
+			ID:           ticket.ID,
+			Subject:      ticket.Subject,
+			Status:       ticket.Status,
+			Priority:     ticket.Priority,
+			AssigneeID:   ticket.AssigneeID,
+			Organization: w.orgNames[ticket.OrganizationID],
+		}
+		if s, ok := seen[ticket.ID]; ok {
+			q.FirstSeen = s.FirstSeen
+		}
+		v.queue = append(v.queue, q)
+	}
+}
+
+func (w *watcher) status() watchStatusResponse {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	res := watchStatusResponse{StartedAt: w.startedAt, Views: []watchViewStatus{}}
+	for _, v := range w.views {
+		s := watchViewStatus{
+			Name:     v.Name,
+			ID:       v.ID,
+			Failures: v.failures,
+			NextPoll: v.next,
+			Queue:    v.queue,
+		}
+		if !v.lastPoll.IsZero() {
+			lastPoll := v.lastPoll
+			s.LastPoll = &lastPoll
+		}
+		if v.lastErr != nil {
+			s.LastError = v.lastErr.Error()
+		}
+		if s.Queue == nil {
+			s.Queue = []watchQueueTicket{}
+		}
+		res.Views = append(res.Views, s)
+	}
+
+	return res
+}
+
+// serveStatus serves the status API on the unix socket until ctx is done:
+// GET /status returns the queue and the last poll of every view
+func (w *watcher) serveStatus(ctx context.Context, socket string) error {
+	if err := os.MkdirAll(filepath.Dir(socket), 0700); err != nil {
+		return fmt.Errorf("failed to create socket dir: %w", err)
+	}
+
+	// a socket nobody answers on was left by a daemon that did not stop cleanly
+	if conn, err := net.Dial("unix", socket); err == nil {
+		conn.Close()
+		return fmt.Errorf("another watcher is already running on %s", socket)
+	}
+	if err := os.Remove(socket); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", socket, err)
+	}
+	if err := os.Chmod(socket, 0600); err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to restrict socket access: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(rw).Encode(w.status()); err != nil {
+			slog.Error("Failed to write status", "error", err)
+		}
+	})
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Status API stopped", "error", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julientant/supportctl/zendesk/zendesktest"
+	"github.com/spf13/viper"
+)
+
+func TestWatchDaemonStatus(t *testing.T) {
+	setupTest(t)
+	viper.Set("watch.views", []map[string]any{
+		{"name": zendesktest.FixtureViewTitle, "notifier": "stdout"},
+	})
+	// unix socket paths are limited to about a hundred bytes, shorter than most temp dirs
+	socketDir, err := os.MkdirTemp("", "sctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(socketDir)
+	socket := filepath.Join(socketDir, "watch.sock")
+	viper.Set("watch.socket", socket)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- runCommand(ctx, t, "watch", "--daemon")
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+
+	var status watchStatusResponse
+	for {
+		resp, err := client.Get("http://supportctl/status")
+		if err == nil {
+			err = json.NewDecoder(resp.Body).Decode(&status)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(status.Views) == 1 && status.Views[0].LastPoll != nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Fatalf("status API never reported a poll: %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	view := status.Views[0]
+	if view.Name != zendesktest.FixtureViewTitle || len(view.Queue) != 1 || view.Queue[0].ID != zendesktest.FixtureOpenTicketID {
+		t.Errorf("unexpected status %+v", view)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("watch failed: %s", err)
+	}
+}
+
+func TestPollBackoff(t *testing.T) {
+	for failures, want := range map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		5:  8 * time.Minute,
+		10: 15 * time.Minute,
+	} {
+		if got := pollBackoff(failures); got != want {
+			t.Errorf("pollBackoff(%d) = %s, want %s", failures, got, want)
+		}
+	}
+}
+
+func TestWatchInstallService(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("systemd is linux only")
+	}
+	setupTest(t)
+
+	if err := runCommand(nil, t, "watch", "install-service"); err != nil {
+		t.Fatalf("install-service failed: %s", err)
+	}
+
+	configDir, _ := os.UserConfigDir()
+	unit, err := os.ReadFile(filepath.Join(configDir, "systemd", "user", "supportctl-watch.service"))
+	if err != nil {
+		t.Fatalf("unit should have been written: %s", err)
+	}
+	if !strings.Contains(string(unit), " watch --daemon") {
+		t.Errorf("unit should run the daemon, got:\n%s", unit)
+	}
+
+	if err := runCommand(nil, t, "watch", "install-service"); err == nil {
+		t.Error("an existing unit should not be replaced without --force")
+	}
+}
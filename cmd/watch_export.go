@@ -0,0 +1,272 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julientant/supportctl/zendesk"
+	zdlib "github.com/nukosuke/go-zendesk/zendesk"
+	"github.com/spf13/viper"
+)
+
+// watch.mode values
+const (
+	// watchModeView fetches every page of the views on each poll
+	watchModeView = "view"
+	// watchModeExport reads the tickets changed since the last poll from the incremental export,
+	// and works out locally which views they belong to from the conditions of the views
+	watchModeExport = "export"
+)
+
+// ticket fields in the order used by the less_than and greater_than conditions
+var (
+	statusOrder   = []string{"new", "open", "pending", "hold", "solved", "closed"}
+	priorityOrder = []string{"", "low", "normal", "high", "urgent"}
+)
+
+// viewMatcher tells whether a view lists a ticket
+type viewMatcher func(ticket zdlib.Ticket) bool
+
+// exportFeed follows the incremental export for the views whose conditions can be evaluated locally
+type exportFeed struct {
+	views    []*watchedView
+	next     time.Time
+	resyncAt time.Time
+	failures int
+}
+
+// setupExport prepares the export mode, views using conditions it cannot evaluate keep being polled.
+// It returns nil when no view can use the export.
+func (w *watcher) setupExport(ctx context.Context, views []*watchedView) (*exportFeed, error) {
+	me, err := w.currentUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	feed := &exportFeed{}
+	for _, v := range views {
+		conditions, err := w.zd.GetViewConditions(ctx, v.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the conditions of view %s: %w", v.Name, err)
+		}
+
+		match, err := compileViewConditions(conditions, me)
+		if err != nil {
+			log.Printf("View %s is polled, the export mode cannot evaluate its conditions: %s", v.Name, err)
+			continue
+		}
+		v.match = match
+		feed.views = append(feed.views, v)
+	}
+
+	if len(feed.views) == 0 {
+		return nil, nil
+	}
+
+	return feed, nil
+}
+
+// pollExport applies the tickets changed since the last poll to the views of the feed, then
+// notifies them like a poll of the views would. The views are fetched in full on the first poll
+// and every watch.export.resync minutes, to catch up with changes the conditions miss.
+func (w *watcher) pollExport(ctx context.Context, feed *exportFeed, now time.Time) error {
+	key := viper.GetString("zendesk.subdomain")
+	cursor := w.state.Cursors[key]
+	// zendesk wants a start time at least a minute old, the overlap with the fetch of the views is harmless
+	startTime := now.Add(-time.Minute)
+
+	if !now.Before(feed.resyncAt) {
+		for _, v := range feed.views {
+			tickets, err := viewTickets(ctx, w.zd, v.ID)
+			if err != nil {
+				return err
+			}
+			v.tickets = map[int64]zdlib.Ticket{}
+			for _, ticket := range tickets {
+				v.tickets[ticket.ID] = ticket
+			}
+		}
+		if resync := viper.GetInt64("watch.export.resync"); resync > 0 {
+			feed.resyncAt = now.Add(time.Minute * time.Duration(resync))
+		} else {
+			feed.resyncAt = now.Add(100 * 365 * 24 * time.Hour)
+		}
+	}
+
+	for {
+		page, err := w.zd.ExportTickets(ctx, cursor, startTime)
+		if err != nil {
+			return fmt.Errorf("failed to export tickets: %w", err)
+		}
+
+		for _, ticket := range page.Tickets {
+			for _, v := range feed.views {
+				if ticket.Status != zendesk.TicketStatusDeleted && v.match(ticket) {
+					v.tickets[ticket.ID] = ticket
+				} else {
+					delete(v.tickets, ticket.ID)
+				}
+			}
+		}
+
+		// an empty cursor would start over from the start time
+		if page.AfterCursor != "" {
+			cursor = page.AfterCursor
+		}
+		if page.EndOfStream || len(page.Tickets) == 0 {
+			break
+		}
+	}
+	// saved with the seen tickets by process
+	w.state.Cursors[key] = cursor
+
+	for _, v := range feed.views {
+		tickets := make([]zdlib.Ticket, 0, len(v.tickets))
+		for _, ticket := range v.tickets {
+			tickets = append(tickets, ticket)
+		}
+		sort.Slice(tickets, func(i, j int) bool { return tickets[i].ID < tickets[j].ID })
+
+		tickets, err := w.process(ctx, v, tickets)
+		w.record(v, now, tickets, err)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// compileViewConditions turns the conditions of a view into a matcher, the conditions
+// on fields the export does not carry, or that need more than the ticket, are an error
+func compileViewConditions(conditions zendesk.ViewConditions, currentUserID int64) (viewMatcher, error) {
+	all := []viewMatcher{}
+	for _, c := range conditions.All {
+		m, err := compileViewCondition(c, currentUserID)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, m)
+	}
+	anyOf := []viewMatcher{}
+	for _, c := range conditions.Any {
+		m, err := compileViewCondition(c, currentUserID)
+		if err != nil {
+			return nil, err
+		}
+		anyOf = append(anyOf, m)
+	}
+
+	return func(ticket zdlib.Ticket) bool {
+		for _, m := range all {
+			if !m(ticket) {
+				return false
+			}
+		}
+		if len(anyOf) == 0 {
+			return true
+		}
+		for _, m := range anyOf {
+			if m(ticket) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+func compileViewCondition(c zendesk.ViewCondition, currentUserID int64) (viewMatcher, error) {
+	value := ""
+	switch v := c.Value.(type) {
+	case nil:
+	case float64:
+		// ids are decoded as floats, fmt would print the large ones with an exponent
+		value = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		value = fmt.Sprint(v)
+	}
+	unsupported := fmt.Errorf("unsupported condition %s %s %q", c.Field, c.Operator, value)
+
+	switch c.Field {
+	case "status":
+		return compileOrdered(c.Operator, value, statusOrder, func(t zdlib.Ticket) string { return t.Status }, unsupported)
+	case "priority":
+		return compileOrdered(c.Operator, value, priorityOrder, func(t zdlib.Ticket) string { return t.Priority }, unsupported)
+	case "type":
+		return compileEquals(c.Operator, func(t zdlib.Ticket) bool { return t.Type == value }, unsupported)
+	case "assignee_id", "requester_id", "group_id", "organization_id":
+		var id int64
+		switch value {
+		case "":
+		case "current_user":
+			if c.Field != "assignee_id" && c.Field != "requester_id" {
+				return nil, unsupported
+			}
+			id = currentUserID
+		default:
+			var err error
+			if id, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return nil, unsupported
+			}
+		}
+
+		field := map[string]func(zdlib.Ticket) int64{
+			"assignee_id":     func(t zdlib.Ticket) int64 { return t.AssigneeID },
+			"requester_id":    func(t zdlib.Ticket) int64 { return t.RequesterID },
+			"group_id":        func(t zdlib.Ticket) int64 { return t.GroupID },
+			"organization_id": func(t zdlib.Ticket) int64 { return t.OrganizationID },
+		}[c.Field]
+		return compileEquals(c.Operator, func(t zdlib.Ticket) bool { return field(t) == id }, unsupported)
+	case "current_tags":
+		tags := strings.Fields(value)
+		hasTag := func(t zdlib.Ticket) bool {
+			for _, tag := range tags {
+				if containsString(t.Tags, tag) {
+					return true
+				}
+			}
+			return false
+		}
+		switch c.Operator {
+		case "includes":
+			return hasTag, nil
+		case "not_includes":
+			return func(t zdlib.Ticket) bool { return !hasTag(t) }, nil
+		}
+	}
+
+	return nil, unsupported
+}
+
+func compileEquals(operator string, equals viewMatcher, unsupported error) (viewMatcher, error) {
+	switch operator {
+	case "is":
+		return equals, nil
+	case "is_not":
+		return func(t zdlib.Ticket) bool { return !equals(t) }, nil
+	}
+
+	return nil, unsupported
+}
+
+func compileOrdered(operator, value string, order []string, field func(zdlib.Ticket) string, unsupported error) (viewMatcher, error) {
+	rank := slices.Index(order, value)
+	if rank < 0 {
+		return nil, unsupported
+	}
+
+	switch operator {
+	case "less_than":
+		return func(t zdlib.Ticket) bool { return slices.Index(order, field(t)) < rank }, nil
+	case "greater_than":
+		return func(t zdlib.Ticket) bool { return slices.Index(order, field(t)) > rank }, nil
+	}
+
+	return compileEquals(operator, func(t zdlib.Ticket) bool { return field(t) == value }, unsupported)
+}
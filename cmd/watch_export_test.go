@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julientant/supportctl/notify"
+	"github.com/julientant/supportctl/zendesk"
+	"github.com/julientant/supportctl/zendesk/zendesktest"
+	zdlib "github.com/nukosuke/go-zendesk/zendesk"
+	"github.com/spf13/viper"
+)
+
+func TestWatchExport(t *testing.T) {
+	server, _ := setupTest(t)
+	server.ViewConditions[zendesktest.FixtureViewID] = zendesk.ViewConditions{All: []zendesk.ViewCondition{
+		{Field: "status", Operator: "less_than", Value: "solved"},
+		{Field: "assignee_id", Operator: "is", Value: nil},
+	}}
+	viper.Set("watch.mode", watchModeExport)
+	viper.Set("watch.views", []map[string]any{
+		{"name": zendesktest.FixtureViewTitle, "notifier": "stdout"},
+	})
+
+	watchOnce := func() []int64 {
+		out := &bytes.Buffer{}
+		rootCmd.SetOut(out)
+		defer rootCmd.SetOut(nil)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		if err := runCommand(ctx, t, "watch"); err != nil {
+			t.Fatalf("watch failed: %s", err)
+		}
+
+		ids := []int64{}
+		dec := json.NewDecoder(out)
+		for dec.More() {
+			var e notify.Event
+			if err := dec.Decode(&e); err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, e.Ticket.ID)
+		}
+		return ids
+	}
+
+	// the first poll fetches the view
+	if ids := watchOnce(); len(ids) != 1 || ids[0] != zendesktest.FixtureOpenTicketID {
+		t.Fatalf("expected ticket %d to be notified, got %v", zendesktest.FixtureOpenTicketID, ids)
+	}
+	path, err := watchStatePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := loadWatchState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Cursors[viper.GetString("zendesk.subdomain")] == "" {
+		t.Fatal("the export cursor should be saved")
+	}
+
+	// the view does not list the new tickets, only the export brings them
+	now := time.Now()
+	server.AddTicket(zdlib.Ticket{ID: 1005, Subject: "Cannot log in", Status: "new", CreatedAt: &now, UpdatedAt: &now})
+	server.AddTicket(zdlib.Ticket{ID: 1006, Subject: "Already taken", Status: "new", AssigneeID: zendesktest.FixtureAgentID, CreatedAt: &now, UpdatedAt: &now})
+
+	if ids := watchOnce(); len(ids) != 1 || ids[0] != 1005 {
+		t.Fatalf("expected ticket 1005 to be notified, got %v", ids)
+	}
+
+	exports := 0
+	for _, p := range server.Requests {
+		if strings.HasSuffix(p, "/incremental/tickets/cursor.json") {
+			exports++
+		}
+	}
+	if exports == 0 {
+		t.Error("the incremental export should be used")
+	}
+}
+
+func TestWatchExportFallsBackToPolling(t *testing.T) {
+	server, _ := setupTest(t)
+	server.ViewConditions[zendesktest.FixtureViewID] = zendesk.ViewConditions{All: []zendesk.ViewCondition{
+		{Field: "satisfaction_score", Operator: "is", Value: "offered"},
+	}}
+	viper.Set("watch.mode", watchModeExport)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	alerts := captureAlerts(t, cancel)
+
+	if err := runCommand(ctx, t, "watch"); err != nil {
+		t.Fatalf("watch failed: %s", err)
+	}
+	if len(*alerts) != 1 {
+		t.Fatalf("the view should be polled, got %v", *alerts)
+	}
+	for _, p := range server.Requests {
+		if strings.HasSuffix(p, "/incremental/tickets/cursor.json") {
+			t.Fatal("the export should not be used without a view it can evaluate")
+		}
+	}
+}
+
+func TestCompileViewConditions(t *testing.T) {
+	ticket := zdlib.Ticket{Status: "open", Priority: "high", AssigneeID: 7, GroupID: 360001234567, Tags: []string{"enterprise", "mobile"}}
+
+	tests := []struct {
+		name       string
+		conditions zendesk.ViewConditions
+		want       bool
+	}{
+		{"no conditions", zendesk.ViewConditions{}, true},
+		{"status below solved", zendesk.ViewConditions{All: []zendesk.ViewCondition{{Field: "status", Operator: "less_than", Value: "solved"}}}, true},
+		{"status above open", zendesk.ViewConditions{All: []zendesk.ViewCondition{{Field: "status", Operator: "greater_than", Value: "open"}}}, false},
+		{"priority", zendesk.ViewConditions{All: []zendesk.ViewCondition{{Field: "priority", Operator: "is", Value: "high"}}}, true},
+		{"unassigned", zendesk.ViewConditions{All: []zendesk.ViewCondition{{Field: "assignee_id", Operator: "is", Value: nil}}}, false},
+		{"assigned to me", zendesk.ViewConditions{All: []zendesk.ViewCondition{{Field: "assignee_id", Operator: "is", Value: "current_user"}}}, true},
+		{"group id as a number", zendesk.ViewConditions{All: []zendesk.ViewCondition{{Field: "group_id", Operator: "is", Value: 360001234567.0}}}, true},
+		{"tags", zendesk.ViewConditions{All: []zendesk.ViewCondition{{Field: "current_tags", Operator: "not_includes", Value: "spam mobile"}}}, false},
+		{"any", zendesk.ViewConditions{Any: []zendesk.ViewCondition{
+			{Field: "status", Operator: "is", Value: "new"},
+			{Field: "current_tags", Operator: "includes", Value: "enterprise"},
+		}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, err := compileViewConditions(tt.conditions, 7)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := match(ticket); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	_, err := compileViewConditions(zendesk.ViewConditions{All: []zendesk.ViewCondition{{Field: "group_id", Operator: "is", Value: "current_groups"}}}, 7)
+	if err == nil {
+		t.Error("current_groups should not be supported")
+	}
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/julientant/supportctl/notify"
+	"github.com/spf13/viper"
+)
+
+// notifier types, desktop and stdout are also the names of the notifiers available without config
+const (
+	notifierDesktop    = "desktop"
+	notifierStdout     = "stdout"
+	notifierMattermost = "mattermost"
+	notifierCommand    = "command"
+)
+
+// notifierConfig is an entry of the watch.notifiers config
+type notifierConfig struct {
+	Type string `mapstructure:"type"`
+
+	// mattermost
+	WebhookURL string `mapstructure:"webhook-url"`
+	Channel    string `mapstructure:"channel"`
+	Username   string `mapstructure:"username"`
+	IconURL    string `mapstructure:"icon-url"`
+	Mention    string `mapstructure:"mention"`
+
+	// command
+	Command []string `mapstructure:"command"`
+
+	// Title and Message are text/template templates of the notification
+	Title   string `mapstructure:"title"`
+	Message string `mapstructure:"message"`
+
+	// IgnoreSchedule notifies around the clock, even when watch.schedule is set
+	IgnoreSchedule bool `mapstructure:"ignore-schedule"`
+}
+
+// loadNotifiers returns the notifiers of watch.notifiers by name, along with the default desktop and stdout ones.
+// stdout notifiers write to out. They follow watch.schedule unless their config says otherwise.
+func loadNotifiers(out io.Writer) (map[string]notify.Notifier, error) {
+	configs := map[string]notifierConfig{
+		notifierDesktop: {Type: notifierDesktop},
+		notifierStdout:  {Type: notifierStdout},
+	}
+	if err := viper.UnmarshalKey("watch.notifiers", &configs); err != nil {
+		return nil, fmt.Errorf("failed to read watch.notifiers: %w", err)
+	}
+	schedule, digest, err := loadSchedule()
+	if err != nil {
+		return nil, err
+	}
+
+	notifiers := map[string]notify.Notifier{}
+	for name, c := range configs {
+		// the default notifiers can be configured, to change their templates, without repeating their type
+		if c.Type == "" && (name == notifierDesktop || name == notifierStdout) {
+			c.Type = name
+		}
+
+		n, err := newNotifier(c, out)
+		if err != nil {
+			return nil, fmt.Errorf("notifier %s: %w", name, err)
+		}
+
+		t, err := notify.NewTemplate(c.Title, c.Message)
+		if err != nil {
+			return nil, fmt.Errorf("notifier %s: %w", name, err)
+		}
+		notifiers[name] = notify.Templated(n, t)
+		if schedule != nil && !c.IgnoreSchedule {
+			notifiers[name] = &notify.Scheduled{Notifier: notifiers[name], Schedule: schedule, Digest: digest}
+		}
+	}
+
+	return notifiers, nil
+}
+
+func newNotifier(c notifierConfig, out io.Writer) (notify.Notifier, error) {
+	switch c.Type {
+	case notifierDesktop:
+		// sendAlert is looked up on every notification so tests can replace it
+		return &notify.Desktop{
+			Alert: func(title, message, appIcon string) error {
+				return sendAlert(title, message, appIcon)
+			},
+			Quiet: func(title, message, appIcon string) error {
+				return sendQuietAlert(title, message, appIcon)
+			},
+		}, nil
+	case notifierStdout:
+		return &notify.JSONLines{W: out}, nil
+	case notifierMattermost:
+		if c.WebhookURL == "" {
+			return nil, fmt.Errorf("webhook-url is not set")
+		}
+		return &notify.Mattermost{
+			WebhookURL: c.WebhookURL,
+			Channel:    c.Channel,
+			Username:   c.Username,
+			IconURL:    c.IconURL,
+			Mention:    c.Mention,
+		}, nil
+	case notifierCommand:
+		if len(c.Command) == 0 {
+			return nil, fmt.Errorf("command is not set")
+		}
+		return &notify.Command{Args: c.Command}, nil
+	default:
+		return nil, fmt.Errorf("unknown type %q, must be desktop, stdout, mattermost or command", c.Type)
+	}
+}
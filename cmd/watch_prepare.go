@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/julientant/supportctl/manifest"
+	"github.com/julientant/supportctl/ticketprep"
+	"github.com/julientant/supportctl/workspace"
+	"github.com/julientant/supportctl/zendesk"
+	zdlib "github.com/nukosuke/go-zendesk/zendesk"
+	"github.com/spf13/viper"
+)
+
+// prepareBackoff returns how long to wait before preparing a ticket again after the given number of failures
+var prepareBackoff = pollBackoff
+
+// ticketPreparer runs get in the background for the tickets the watcher finds,
+// at most watch.prepare.concurrency at a time
+type ticketPreparer struct {
+	zd  zendesk.API
+	ws  workspace.Workspace
+	sem chan struct{}
+	wg  sync.WaitGroup
+
+	mu       sync.Mutex
+	attempts map[int64]*prepareAttempt
+}
+
+// prepareAttempt is where the preparation of a ticket stands during this run
+type prepareAttempt struct {
+	running  bool
+	done     bool
+	failures int
+	retryAt  time.Time
+}
+
+func newTicketPreparer(zd zendesk.API, ws workspace.Workspace) *ticketPreparer {
+	return &ticketPreparer{
+		zd:       zd,
+		ws:       ws,
+		sem:      make(chan struct{}, max(viper.GetInt("watch.prepare.concurrency"), 1)),
+		attempts: map[int64]*prepareAttempt{},
+	}
+}
+
+// prepare starts preparing the ticket unless all the stages already ran on it.
+// A folder left by a failed or interrupted preparation is prepared again,
+// a failed preparation is retried on a later poll, waiting longer after each failure.
+func (p *ticketPreparer) prepare(ctx context.Context, ticket zdlib.Ticket) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	a, ok := p.attempts[ticket.ID]
+	if !ok {
+		a = &prepareAttempt{}
+		p.attempts[ticket.ID] = a
+	}
+	if a.running || a.done || time.Now().Before(a.retryAt) {
+		return
+	}
+	// get with --only or --skip leaves a ticket partly prepared
+	if m, err := manifest.Load(getTicketFolderPath(strconv.FormatInt(ticket.ID, 10))); err == nil && ticketprep.Prepared(m) {
+		a.done = true
+		return
+	}
+	a.running = true
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		select {
+		case p.sem <- struct{}{}:
+		case <-ctx.Done():
+			p.finish(a, ctx.Err())
+			return
+		}
+		defer func() { <-p.sem }()
+
+		log.Printf("Preparing ticket %d", ticket.ID)
+		err := prepareTicket(ctx, p.zd, p.ws, ticket.ID, ticketprep.Stages)
+		if ctx.Err() != nil {
+			// the watcher is stopping, the next run prepares the ticket again
+			err = ctx.Err()
+		}
+		retryAt := p.finish(a, err)
+		switch {
+		case ctx.Err() != nil:
+		case errors.Is(err, workspace.ErrBusy):
+			log.Printf("Skipping the preparation of ticket %d: %s", ticket.ID, err)
+		case err != nil:
+			log.Printf("Failed to prepare ticket %d, retrying after %s: %s", ticket.ID, retryAt.Format(time.RFC3339), err)
+		default:
+			log.Printf("Ticket %d is ready in %s", ticket.ID, getTicketFolderPath(strconv.FormatInt(ticket.ID, 10)))
+		}
+	}()
+}
+
+// finish records the outcome of a preparation and returns when it can be retried.
+// A ticket busy with another command is looked at again on the next poll, it is likely being prepared.
+func (p *ticketPreparer) finish(a *prepareAttempt, err error) time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	a.running = false
+	switch {
+	case err == nil:
+		a.done = true
+		a.failures = 0
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded), errors.Is(err, workspace.ErrBusy):
+	default:
+		a.failures++
+		a.retryAt = time.Now().Add(prepareBackoff(a.failures))
+	}
+
+	return a.retryAt
+}
+
+// wait returns once the preparations started are done
+func (p *ticketPreparer) wait() {
+	p.wg.Wait()
+}
+
+// prepareTickets starts preparing the tickets of the view when the view asks for it,
+// or when they are assigned to the current user and watch.prepare.assigned is set
+func (w *watcher) prepareTickets(ctx context.Context, v *watchedView, tickets []zdlib.Ticket) {
+	if w.preparer == nil {
+		return
+	}
+
+	for _, ticket := range tickets {
+		if v.Prepare || (w.prepareAssigned && ticket.AssigneeID != 0 && ticket.AssigneeID == w.me) {
+			w.preparer.prepare(ctx, ticket)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/julientant/supportctl/notify"
+	"github.com/spf13/viper"
+)
+
+// watch.schedule.outside-hours values
+const (
+	// outsideHoursDigest sends the notifications held back outside working hours when the shift starts
+	outsideHoursDigest = "digest"
+	// outsideHoursSuppress drops the notifications outside working hours
+	outsideHoursSuppress = "suppress"
+)
+
+// weekdaysKey sets the hours of monday to friday in watch.schedule.hours, the days can still set their own
+const weekdaysKey = "weekdays"
+
+// scheduleConfig is the watch.schedule config
+type scheduleConfig struct {
+	// Timezone is an IANA name like Europe/Paris, the local timezone when unset
+	Timezone string `mapstructure:"timezone"`
+	// Hours are the working hours by lowercase weekday, like 09:00-18:00, off or empty for a day off
+	Hours        map[string]string `mapstructure:"hours"`
+	Holidays     string            `mapstructure:"holidays"`
+	OutsideHours string            `mapstructure:"outside-hours"`
+}
+
+// loadSchedule returns the working schedule and whether to send a digest of the notifications held back,
+// the schedule is nil when watch.schedule.hours is not set
+func loadSchedule() (*notify.Schedule, bool, error) {
+	c := scheduleConfig{OutsideHours: outsideHoursDigest}
+	if err := viper.UnmarshalKey("watch.schedule", &c); err != nil {
+		return nil, false, fmt.Errorf("failed to read watch.schedule: %w", err)
+	}
+	if len(c.Hours) == 0 {
+		return nil, false, nil
+	}
+
+	var digest bool
+	switch c.OutsideHours {
+	case outsideHoursDigest:
+		digest = true
+	case outsideHoursSuppress:
+	default:
+		return nil, false, fmt.Errorf("invalid watch.schedule.outside-hours %q, it must be %s or %s", c.OutsideHours, outsideHoursDigest, outsideHoursSuppress)
+	}
+
+	s := &notify.Schedule{Location: time.Local, Hours: map[time.Weekday]notify.WorkingHours{}}
+	if c.Timezone != "" {
+		loc, err := time.LoadLocation(c.Timezone)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid watch.schedule.timezone: %w", err)
+		}
+		s.Location = loc
+	}
+
+	days := map[string]time.Weekday{}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		days[strings.ToLower(d.String())] = d
+	}
+	if hours, ok := c.Hours[weekdaysKey]; ok {
+		for d := time.Monday; d <= time.Friday; d++ {
+			if _, ok := c.Hours[strings.ToLower(d.String())]; !ok {
+				c.Hours[strings.ToLower(d.String())] = hours
+			}
+		}
+		delete(c.Hours, weekdaysKey)
+	}
+	for name, hours := range c.Hours {
+		day, ok := days[strings.ToLower(name)]
+		if !ok {
+			return nil, false, fmt.Errorf("invalid day %q in watch.schedule.hours", name)
+		}
+		if hours == "" || hours == "off" {
+			continue
+		}
+		h, err := notify.ParseWorkingHours(hours)
+		if err != nil {
+			return nil, false, fmt.Errorf("watch.schedule.hours.%s: %w", name, err)
+		}
+		s.Hours[day] = h
+	}
+
+	if c.Holidays != "" {
+		holidays, err := notify.LoadHolidays(c.Holidays)
+		if err != nil {
+			return nil, false, err
+		}
+		s.Holidays = holidays
+	}
+
+	return s, digest, nil
+}
+
+// scheduledNotifiers returns the notifiers of the views that follow the schedule, by name
+func scheduledNotifiers(views []*watchedView) map[string]*notify.Scheduled {
+	scheduled := map[string]*notify.Scheduled{}
+	for _, v := range views {
+		if s, ok := v.notifier.(*notify.Scheduled); ok {
+			scheduled[v.Notifier] = s
+		}
+	}
+
+	return scheduled
+}
+
+// flushDigests sends the notifications held back outside working hours once the shift starts,
+// they are kept for the next attempt when a notifier fails
+func (w *watcher) flushDigests(ctx context.Context) {
+	sent := false
+	for name, s := range w.scheduled {
+		if len(s.Held()) == 0 {
+			continue
+		}
+		if err := s.Flush(ctx); err != nil {
+			log.Printf("Failed to send the digest of notifier %s: %s", name, err)
+			continue
+		}
+		sent = sent || len(s.Held()) == 0
+	}
+
+	if sent {
+		w.syncHeld()
+		if err := w.state.save(w.statePath); err != nil {
+			log.Printf("Failed to save watch state: %s", err)
+		}
+	}
+}
+
+// syncHeld copies the notifications held back to the state, so a restart does not lose them
+func (w *watcher) syncHeld() {
+	for name, s := range w.scheduled {
+		if held := s.Held(); len(held) > 0 {
+			w.state.Held[name] = held
+		} else {
+			delete(w.state.Held, name)
+		}
+	}
+}
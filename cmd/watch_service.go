@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+)
+
+var systemdUnitTemplate = template.Must(template.New("unit").Parse(`[Unit]
+Description=supportctl zendesk view watcher{{with .Profile}} ({{.}}){{end}}
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+ExecStart={{.ExecStart}}
+Restart=on-failure
+RestartSec=30
+
+[Install]
+WantedBy=default.target
+`))
+
+// watchInstallServiceCmd represents the watch install-service command
+var watchInstallServiceCmd = &cobra.Command{
+	Use:   "install-service",
+	Short: "Install a systemd user service running the watcher as a daemon",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if runtime.GOOS != "linux" {
+			return errors.New("systemd services are only available on linux")
+		}
+
+		execArgs, err := supportctlArgs("watch", "--daemon")
+		if err != nil {
+			return err
+		}
+		name := "supportctl-watch.service"
+		if profile := activeProfile(); profile != "" {
+			name = "supportctl-watch-" + profile + ".service"
+		}
+
+		quoted := make([]string, len(execArgs))
+		for i, arg := range execArgs {
+			quoted[i] = systemdQuote(arg)
+		}
+
+		var unit bytes.Buffer
+		err = systemdUnitTemplate.Execute(&unit, map[string]string{
+			"Profile":   activeProfile(),
+			"ExecStart": strings.Join(quoted, " "),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to render unit: %w", err)
+		}
+
+		if printOnly, _ := cmd.Flags().GetBool("print"); printOnly {
+			_, err := cmd.OutOrStdout().Write(unit.Bytes())
+			return err
+		}
+
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			return fmt.Errorf("failed to get config dir: %w", err)
+		}
+		path := filepath.Join(configDir, "systemd", "user", name)
+
+		force, _ := cmd.Flags().GetBool("force")
+		if _, err := os.Stat(path); err == nil && !force {
+			return fmt.Errorf("%s already exists, use --force to replace it", path)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create systemd user dir: %w", err)
+		}
+		if err := os.WriteFile(path, unit.Bytes(), 0644); err != nil {
+			return fmt.Errorf("failed to write unit: %w", err)
+		}
+
+		log.Printf("Installed %s, start it with:", path)
+		log.Printf("  systemctl --user daemon-reload && systemctl --user enable --now %s", name)
+
+		return nil
+	},
+}
+
+// systemdQuote quotes an ExecStart argument when it needs to be
+func systemdQuote(arg string) string {
+	if !strings.ContainsAny(arg, " \t\"'\\$%") {
+		return arg
+	}
+
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `$$`, `%`, `%%`)
+	return `"` + r.Replace(arg) + `"`
+}
+
+func init() {
+	watchCmd.AddCommand(watchInstallServiceCmd)
+
+	watchInstallServiceCmd.Flags().Bool("print", false, "print the unit instead of installing it")
+	watchInstallServiceCmd.Flags().Bool("force", false, "replace an existing unit")
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/julientant/supportctl/notify"
+	"github.com/julientant/supportctl/zendesk"
+	zdlib "github.com/nukosuke/go-zendesk/zendesk"
+	"github.com/spf13/viper"
+)
+
+// SLA levels, from the least to the most urgent
+const (
+	slaLevelWarning  = "warning"
+	slaLevelCritical = "critical"
+	slaLevelBreached = "breached"
+)
+
+var slaLevelRank = map[string]int{
+	slaLevelWarning:  1,
+	slaLevelCritical: 2,
+	slaLevelBreached: 3,
+}
+
+var slaLevelUrgency = map[string]string{
+	slaLevelWarning:  notify.UrgencyLow,
+	slaLevelCritical: notify.UrgencyNormal,
+	slaLevelBreached: notify.UrgencyHigh,
+}
+
+// slaAlert remembers the last level notified for an SLA target of a ticket
+type slaAlert struct {
+	BreachAt time.Time `json:"breach_at"`
+	Level    string    `json:"level"`
+}
+
+// slaLevel tells how close a breach is: warning within the window, critical in its last quarter
+// and breached past it. It is empty while the breach is further than the window.
+func slaLevel(remaining, window time.Duration) string {
+	switch {
+	case remaining <= 0:
+		return slaLevelBreached
+	case remaining <= window/4:
+		return slaLevelCritical
+	case remaining <= window:
+		return slaLevelWarning
+	default:
+		return ""
+	}
+}
+
+// checkSLAs notifies the tickets getting close to missing their first or next reply target,
+// once per level so the notifications escalate as the deadline nears
+func (w *watcher) checkSLAs(ctx context.Context, v *watchedView, tickets []zdlib.Ticket, seen map[int64]*seenTicket) error {
+	window := time.Minute * time.Duration(viper.GetInt64("watch.sla-warning"))
+	if window <= 0 || len(tickets) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(tickets))
+	for _, ticket := range tickets {
+		ids = append(ids, ticket.ID)
+	}
+	slas, err := w.zd.GetTicketSLAs(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("failed to get ticket slas: %w", err)
+	}
+
+	now := time.Now()
+	for _, ticket := range tickets {
+		// a ticket whose new notification failed is not seen yet
+		s, ok := seen[ticket.ID]
+		if !ok {
+			continue
+		}
+		for _, m := range slas[ticket.ID] {
+			if m.Stage != zendesk.SLAStageActive || m.BreachAt == nil {
+				continue
+			}
+			if m.Metric != zendesk.SLAMetricFirstReply && m.Metric != zendesk.SLAMetricNextReply {
+				continue
+			}
+
+			level := slaLevel(m.BreachAt.Sub(now), window)
+			if level == "" {
+				continue
+			}
+
+			// a new breach time is a new target, like the next reply after an answer
+			previous := s.SLAAlerts[m.Metric]
+			if previous != nil && previous.BreachAt.Equal(*m.BreachAt) && slaLevelRank[previous.Level] >= slaLevelRank[level] {
+				continue
+			}
+
+			e := w.event(ctx, v, notify.KindSLA, ticket, s)
+			e.Urgency = slaLevelUrgency[level]
+			e.SLA = &notify.SLAWarning{Metric: m.Metric, BreachAt: *m.BreachAt, Level: level}
+			if err := v.notifier.Notify(ctx, e); err != nil {
+				return fmt.Errorf("failed to send notification: %w", err)
+			}
+
+			if s.SLAAlerts == nil {
+				s.SLAAlerts = map[string]*slaAlert{}
+			}
+			s.SLAAlerts[m.Metric] = &slaAlert{BreachAt: *m.BreachAt, Level: level}
+		}
+	}
+
+	return nil
+}
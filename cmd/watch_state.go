@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/julientant/supportctl/notify"
+	"github.com/spf13/viper"
+)
+
+// seenTicket is what the watcher remembers about a ticket of a watched view
+type seenTicket struct {
+	FirstSeen    time.Time `json:"first_seen"`
+	LastNotified time.Time `json:"last_notified"`
+	// SLAAlerts is the last SLA level notified, by metric
+	SLAAlerts map[string]*slaAlert `json:"sla_alerts,omitempty"`
+}
+
+// watchState maps a watched view to the tickets already notified in it
+type watchState struct {
+	Views map[string]map[int64]*seenTicket `json:"views"`
+	// Cursors is the position in the incremental ticket export, by subdomain
+	Cursors map[string]string `json:"cursors,omitempty"`
+	// Held are the notifications waiting for the working hours, by notifier
+	Held map[string][]notify.Event `json:"held,omitempty"`
+}
+
+// userStateDir returns the folder for data that must survive restarts but is not configuration,
+// XDG_STATE_HOME on linux
+func userStateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return dir, nil
+	}
+
+	// there is no state dir on the other platforms, the local app data dir is the closest
+	switch runtime.GOOS {
+	case "windows":
+		return os.UserCacheDir()
+	case "darwin", "ios", "plan9":
+		return os.UserConfigDir()
+	default:
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, ".local", "state"), nil
+	}
+}
+
+func watchStatePath() (string, error) {
+	dir, err := userStateDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get state dir: %w", err)
+	}
+
+	return filepath.Join(dir, "supportctl", "watch.json"), nil
+}
+
+// watchStateKey identifies a view across profiles, view ids are only unique within a subdomain
+func watchStateKey(viewID int64) string {
+	return viper.GetString("zendesk.subdomain") + "/" + strconv.FormatInt(viewID, 10)
+}
+
+func loadWatchState(path string) (*watchState, error) {
+	state := &watchState{}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		b = nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read watch state: %w", err)
+	}
+
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, state); err != nil {
+			return nil, fmt.Errorf("failed to decode watch state %s: %w", path, err)
+		}
+	}
+	if state.Views == nil {
+		state.Views = map[string]map[int64]*seenTicket{}
+	}
+	if state.Cursors == nil {
+		state.Cursors = map[string]string{}
+	}
+	if state.Held == nil {
+		state.Held = map[string][]notify.Event{}
+	}
+
+	return state, nil
+}
+
+func (s *watchState) save(path string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", b, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+// view returns the tickets seen in a view, creating the entry on first use
+func (s *watchState) view(key string) map[int64]*seenTicket {
+	seen, ok := s.Views[key]
+	if !ok {
+		seen = map[int64]*seenTicket{}
+		s.Views[key] = seen
+	}
+
+	return seen
+}
@@ -0,0 +1,507 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julientant/supportctl/manifest"
+	"github.com/julientant/supportctl/notify"
+	"github.com/julientant/supportctl/zendesk"
+	"github.com/julientant/supportctl/zendesk/zendesktest"
+	zdlib "github.com/nukosuke/go-zendesk/zendesk"
+	"github.com/spf13/viper"
+)
+
+// captureAlerts records the notifications sent while the test runs,
+// cancel is called on the first one to stop the watcher
+func captureAlerts(t *testing.T, cancel context.CancelFunc) *[]string {
+	alerts := []string{}
+	previous := sendAlert
+	sendAlert = func(title, message, appIcon string) error {
+		alerts = append(alerts, title+": "+message)
+		cancel()
+		return nil
+	}
+	t.Cleanup(func() {
+		sendAlert = previous
+	})
+
+	return &alerts
+}
+
+func TestWatch(t *testing.T) {
+	setupTest(t)
+	viper.Set("watch.view", zendesktest.FixtureViewTitle)
+	viper.Set("watch.frequency", 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	alerts := captureAlerts(t, cancel)
+
+	if err := runCommand(ctx, t, "watch"); err != nil {
+		t.Fatalf("watch failed: %s", err)
+	}
+
+	want := "New ticket #1001: Server crashes on startup (Acme Corp)"
+	if len(*alerts) != 1 || (*alerts)[0] != want {
+		t.Fatalf("expected %q, got %v", want, *alerts)
+	}
+
+	// a restart does not notify the same ticket again
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	alerts = captureAlerts(t, cancel)
+
+	if err := runCommand(ctx, t, "watch"); err != nil {
+		t.Fatalf("watch failed: %s", err)
+	}
+	if len(*alerts) != 0 {
+		t.Fatalf("seen tickets should not be notified again, got %v", *alerts)
+	}
+}
+
+func TestWatchRenotifiesUnassigned(t *testing.T) {
+	setupTest(t)
+	viper.Set("watch.view", zendesktest.FixtureViewTitle)
+	viper.Set("watch.renotify-unassigned-after", 60)
+
+	path, err := watchStatePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	twoHoursAgo := time.Now().Add(-2 * time.Hour)
+	state := &watchState{Views: map[string]map[int64]*seenTicket{
+		watchStateKey(zendesktest.FixtureViewID): {
+			zendesktest.FixtureOpenTicketID: {FirstSeen: twoHoursAgo, LastNotified: twoHoursAgo},
+		},
+	}}
+	if err := state.save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	alerts := captureAlerts(t, cancel)
+
+	if err := runCommand(ctx, t, "watch"); err != nil {
+		t.Fatalf("watch failed: %s", err)
+	}
+
+	if len(*alerts) != 1 || !strings.HasPrefix((*alerts)[0], "Ticket #1001 unassigned for 2h0m0s") {
+		t.Fatalf("unassigned ticket should be notified again, got %v", *alerts)
+	}
+}
+
+func TestWatchFailsOnUnknownView(t *testing.T) {
+	setupTest(t)
+	viper.Set("watch.views", []map[string]any{
+		{"name": zendesktest.FixtureViewTitle},
+		{"name": "Does not exist"},
+	})
+
+	err := runCommand(nil, t, "watch")
+	if err == nil || !strings.Contains(err.Error(), `"Does not exist"`) {
+		t.Fatalf("watch should fail on the unknown view, got %v", err)
+	}
+}
+
+func TestWatchMultipleViews(t *testing.T) {
+	server, _ := setupTest(t)
+	server.AddTicket(zdlib.Ticket{ID: 1010, Subject: "Production down", Status: "new", Priority: "urgent"})
+	server.AddTicket(zdlib.Ticket{ID: 1011, Subject: "Typo in docs", Status: "new", Priority: "low"})
+	server.AddView(zdlib.View{ID: 501, Title: "Urgent", Active: true}, 1010, 1011)
+
+	viper.Set("watch.views", []map[string]any{
+		{"name": zendesktest.FixtureViewTitle, "frequency": 60},
+		{"name": "Urgent", "frequency": 1, "filter": map[string]any{"priorities": []string{"urgent"}}},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	alerts := captureAlerts(t, func() {})
+
+	if err := runCommand(ctx, t, "watch"); err != nil {
+		t.Fatalf("watch failed: %s", err)
+	}
+
+	want := []string{
+		"New ticket #1001: Server crashes on startup (Acme Corp)",
+		"New ticket #1010: Production down",
+	}
+	if strings.Join(*alerts, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("expected %v, got %v", want, *alerts)
+	}
+}
+
+func TestViewsList(t *testing.T) {
+	setupTest(t)
+
+	out := &bytes.Buffer{}
+	rootCmd.SetOut(out)
+	defer rootCmd.SetOut(nil)
+
+	if err := runCommand(nil, t, "views", "list"); err != nil {
+		t.Fatalf("views list failed: %s", err)
+	}
+	if !strings.Contains(out.String(), zendesktest.FixtureViewTitle) {
+		t.Errorf("views list should show %q, got:\n%s", zendesktest.FixtureViewTitle, out)
+	}
+}
+
+func TestViewsPagination(t *testing.T) {
+	server, _ := setupTest(t)
+	server.PageSize = 1
+	server.AddTicket(zdlib.Ticket{ID: 1010, Subject: "Production down", Status: "new", Priority: "urgent"})
+	server.AddView(zdlib.View{ID: 501, Title: "Urgent", Active: true}, 1010)
+	server.AddView(zdlib.View{ID: 502, Title: "Escalated", Active: true})
+
+	out := &bytes.Buffer{}
+	rootCmd.SetOut(out)
+	defer rootCmd.SetOut(nil)
+
+	if err := runCommand(nil, t, "views", "list"); err != nil {
+		t.Fatalf("views list failed: %s", err)
+	}
+	for _, title := range []string{zendesktest.FixtureViewTitle, "Urgent", "Escalated"} {
+		if !strings.Contains(out.String(), title) {
+			t.Errorf("views list should show %q, got:\n%s", title, out)
+		}
+	}
+
+	// a view past the first page can be watched
+	viper.Set("watch.view", "Urgent")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	alerts := captureAlerts(t, cancel)
+
+	if err := runCommand(ctx, t, "watch"); err != nil {
+		t.Fatalf("watch failed: %s", err)
+	}
+	if len(*alerts) != 1 || !strings.Contains((*alerts)[0], "Production down") {
+		t.Fatalf("expected the ticket of the second page view, got %v", *alerts)
+	}
+}
+
+func TestWatchStdoutNotifier(t *testing.T) {
+	setupTest(t)
+	viper.Set("watch.notifiers", map[string]any{
+		"pipe": map[string]any{"type": "stdout", "message": "{{.Ticket.Subject}} in {{.View}}"},
+	})
+	viper.Set("watch.views", []map[string]any{
+		{"name": zendesktest.FixtureViewTitle, "notifier": "pipe"},
+	})
+
+	out := &bytes.Buffer{}
+	rootCmd.SetOut(out)
+	defer rootCmd.SetOut(nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := runCommand(ctx, t, "watch"); err != nil {
+		t.Fatalf("watch failed: %s", err)
+	}
+
+	var e notify.Event
+	if err := json.Unmarshal(out.Bytes(), &e); err != nil {
+		t.Fatalf("stdout should have one JSON event, got %q: %s", out, err)
+	}
+	if e.Ticket.ID != zendesktest.FixtureOpenTicketID || e.Message != "Server crashes on startup in "+zendesktest.FixtureViewTitle {
+		t.Errorf("unexpected event %+v", e)
+	}
+}
+
+func TestWatchSLAEscalation(t *testing.T) {
+	server, _ := setupTest(t)
+	viper.Set("watch.sla-warning", 60)
+	viper.Set("watch.views", []map[string]any{
+		{"name": zendesktest.FixtureViewTitle, "notifier": "stdout"},
+	})
+
+	watchOnce := func() []notify.Event {
+		out := &bytes.Buffer{}
+		rootCmd.SetOut(out)
+		defer rootCmd.SetOut(nil)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		if err := runCommand(ctx, t, "watch"); err != nil {
+			t.Fatalf("watch failed: %s", err)
+		}
+
+		events := []notify.Event{}
+		dec := json.NewDecoder(out)
+		for dec.More() {
+			var e notify.Event
+			if err := dec.Decode(&e); err != nil {
+				t.Fatal(err)
+			}
+			if e.Kind == notify.KindSLA {
+				events = append(events, e)
+			}
+		}
+		return events
+	}
+
+	breachAt := time.Now().Add(10 * time.Minute)
+	server.SLAs[zendesktest.FixtureOpenTicketID] = []zendesk.SLAPolicyMetric{
+		{Metric: zendesk.SLAMetricFirstReply, Stage: zendesk.SLAStageActive, BreachAt: &breachAt},
+	}
+
+	events := watchOnce()
+	if len(events) != 1 || events[0].SLA.Level != slaLevelCritical || events[0].Urgency != notify.UrgencyNormal {
+		t.Fatalf("expected one critical SLA notification, got %+v", events)
+	}
+
+	if events := watchOnce(); len(events) != 0 {
+		t.Fatalf("the same level should not be notified twice, got %+v", events)
+	}
+
+	breachAt = time.Now().Add(-time.Minute)
+	events = watchOnce()
+	if len(events) != 1 || events[0].SLA.Level != slaLevelBreached || events[0].Urgency != notify.UrgencyHigh {
+		t.Fatalf("expected one breached SLA notification, got %+v", events)
+	}
+}
+
+func TestWatchPreparesAssignedTickets(t *testing.T) {
+	server, workDir := setupTest(t)
+	viper.Set("get.cs-repro-repo", makeCSReproRepo(t))
+	viper.Set("watch.prepare.assigned", true)
+	viper.Set("watch.views", []map[string]any{
+		{"name": zendesktest.FixtureViewTitle, "notifier": "stdout"},
+	})
+	rootCmd.SetOut(&bytes.Buffer{})
+	defer rootCmd.SetOut(nil)
+
+	assigned := server.Tickets[zendesktest.FixtureOpenTicketID]
+	assigned.AssigneeID = zendesktest.FixtureAgentID
+	server.AddTicket(assigned)
+	server.AddTicket(zdlib.Ticket{ID: 1012, Subject: "Someone else's", Status: "open", AssigneeID: 99})
+	server.SetViewTickets(zendesktest.FixtureViewID, zendesktest.FixtureOpenTicketID, 1012)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	folder := ticketFolder(workDir, zendesktest.FixtureOpenTicketID)
+	go func() {
+		// stop once the ticket is ready
+		for ctx.Err() == nil {
+			if _, err := manifest.Load(folder); err == nil {
+				cancel()
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	if err := runCommand(ctx, t, "watch"); err != nil {
+		t.Fatalf("watch failed: %s", err)
+	}
+
+	m, err := manifest.Load(folder)
+	if err != nil {
+		t.Fatalf("the assigned ticket should be prepared: %s", err)
+	}
+	if m.SupportPacket == nil || m.SupportPacket.ServerVersion != zendesktest.FixtureServerVersion {
+		t.Errorf("the support packet should be extracted, got %+v", m.SupportPacket)
+	}
+	if _, err := os.Stat(ticketFolder(workDir, 1012)); err == nil {
+		t.Error("tickets assigned to someone else should not be prepared")
+	}
+}
+
+func TestWatchRetriesFailedPreparation(t *testing.T) {
+	server, workDir := setupTest(t)
+	viper.Set("get.cs-repro-repo", makeCSReproRepo(t))
+	server.FailAttachments = 1
+
+	previous := prepareBackoff
+	prepareBackoff = func(int) time.Duration { return 0 }
+	defer func() { prepareBackoff = previous }()
+
+	zd, err := newZendeskClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws, err := openWorkspace()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newTicketPreparer(zd, ws)
+	ticket := server.Tickets[zendesktest.FixtureOpenTicketID]
+	folder := ticketFolder(workDir, zendesktest.FixtureOpenTicketID)
+
+	// the first poll fails halfway, leaving a folder without manifest
+	p.prepare(context.Background(), ticket)
+	p.wait()
+	if _, err := os.Stat(folder); err != nil {
+		t.Fatalf("the failed preparation should leave its folder: %s", err)
+	}
+	if _, err := manifest.Load(folder); err == nil {
+		t.Fatal("the failed preparation should not save a manifest")
+	}
+
+	// the next poll prepares it again
+	p.prepare(context.Background(), ticket)
+	p.wait()
+	m, err := manifest.Load(folder)
+	if err != nil {
+		t.Fatalf("the ticket should be prepared on the next poll: %s", err)
+	}
+	if m.SupportPacket == nil || m.SupportPacket.ServerVersion != zendesktest.FixtureServerVersion {
+		t.Errorf("the support packet should be extracted, got %+v", m.SupportPacket)
+	}
+
+	// once prepared, it is left alone
+	requests := len(server.Requests)
+	p.prepare(context.Background(), ticket)
+	p.wait()
+	if len(server.Requests) != requests {
+		t.Errorf("a prepared ticket should not be prepared again, got %v", server.Requests[requests:])
+	}
+}
+
+func TestWatchPreparesPartlyPreparedTickets(t *testing.T) {
+	_, workDir := setupTest(t)
+	viper.Set("get.cs-repro-repo", makeCSReproRepo(t))
+
+	if err := runCommand(nil, t, "get", formatID(zendesktest.FixtureOpenTicketID), "--only", "ticket"); err != nil {
+		t.Fatalf("get failed: %s", err)
+	}
+
+	zd, err := newZendeskClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws, err := openWorkspace()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newTicketPreparer(zd, ws)
+	p.prepare(context.Background(), zdlib.Ticket{ID: zendesktest.FixtureOpenTicketID})
+	p.wait()
+
+	m, err := manifest.Load(ticketFolder(workDir, zendesktest.FixtureOpenTicketID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.SupportPacket == nil || m.Repro == nil {
+		t.Errorf("the ticket fetched with --only ticket should be fully prepared, got %+v", m)
+	}
+}
+
+func TestWatchScheduleDigest(t *testing.T) {
+	setupTest(t)
+	viper.Set("watch.views", []map[string]any{
+		{"name": zendesktest.FixtureViewTitle, "notifier": "stdout"},
+	})
+
+	watchOnce := func() []notify.Event {
+		out := &bytes.Buffer{}
+		rootCmd.SetOut(out)
+		defer rootCmd.SetOut(nil)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		if err := runCommand(ctx, t, "watch"); err != nil {
+			t.Fatalf("watch failed: %s", err)
+		}
+
+		events := []notify.Event{}
+		dec := json.NewDecoder(out)
+		for dec.More() {
+			var e notify.Event
+			if err := dec.Decode(&e); err != nil {
+				t.Fatal(err)
+			}
+			events = append(events, e)
+		}
+		return events
+	}
+
+	// a day off every day, the notification waits for the shift
+	viper.Set("watch.schedule", map[string]any{"hours": map[string]any{"monday": "off"}})
+	if events := watchOnce(); len(events) != 0 {
+		t.Fatalf("no notification should be sent outside working hours, got %+v", events)
+	}
+
+	viper.Set("watch.schedule", map[string]any{"hours": map[string]any{
+		"weekdays": "00:00-24:00",
+		"saturday": "00:00-24:00",
+		"sunday":   "00:00-24:00",
+	}})
+	events := watchOnce()
+	if len(events) != 1 || events[0].Kind != notify.KindDigest {
+		t.Fatalf("expected a digest, got %+v", events)
+	}
+	if len(events[0].Events) != 1 || events[0].Events[0].Ticket.ID != zendesktest.FixtureOpenTicketID {
+		t.Errorf("the digest should hold the new ticket, got %+v", events[0].Events)
+	}
+
+	if events := watchOnce(); len(events) != 0 {
+		t.Fatalf("the digest should be sent once, got %+v", events)
+	}
+}
+
+// failingNotifier fails the notifications of the given ticket and records the others
+type failingNotifier struct {
+	failTicket int64
+	sent       []int64
+}
+
+func (n *failingNotifier) Notify(_ context.Context, e notify.Event) error {
+	if e.Ticket.ID == n.failTicket {
+		return errors.New("notifier is down")
+	}
+	n.sent = append(n.sent, e.Ticket.ID)
+	return nil
+}
+
+func TestWatchSavesStateOnNotifyFailure(t *testing.T) {
+	setupTest(t)
+	zd, err := newZendeskClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statePath := filepath.Join(t.TempDir(), "watch.json")
+	state, err := loadWatchState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &watcher{zd: zd, state: state, statePath: statePath, orgNames: map[int64]string{}}
+	n := &failingNotifier{failTicket: zendesktest.FixtureSolvedOldID}
+	v := &watchedView{ID: 1, notifier: n}
+	tickets := []zdlib.Ticket{{ID: zendesktest.FixtureOpenTicketID}, {ID: zendesktest.FixtureSolvedOldID}, {ID: zendesktest.FixtureClosedRecentID}}
+
+	if _, err := w.process(context.Background(), v, tickets); err == nil {
+		t.Fatal("expected the notifier error")
+	}
+
+	// the tickets notified before and after the failure are saved, only the failed one is sent again
+	saved, err := loadWatchState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := saved.view(watchStateKey(v.ID))
+	if len(seen) != 2 || seen[zendesktest.FixtureSolvedOldID] != nil {
+		t.Errorf("expected the two notified tickets to be saved, got %v", seen)
+	}
+
+	w.state = saved
+	n.failTicket = 0
+	if _, err := w.process(context.Background(), v, tickets); err != nil {
+		t.Fatalf("process failed: %s", err)
+	}
+	want := []int64{zendesktest.FixtureOpenTicketID, zendesktest.FixtureClosedRecentID, zendesktest.FixtureSolvedOldID}
+	if fmt.Sprint(n.sent) != fmt.Sprint(want) {
+		t.Errorf("expected the notifications %v, got %v", want, n.sent)
+	}
+}
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/julientant/supportctl/notify"
+	"github.com/julientant/supportctl/zendesk"
+	zdlib "github.com/nukosuke/go-zendesk/zendesk"
+	"github.com/spf13/viper"
+)
+
+// errViewsUnavailable is returned when zendesk could not list the views, the daemon tries again later
+var errViewsUnavailable = errors.New("failed to get views")
+
+// watchViewConfig is an entry of the watch.views config
+type watchViewConfig struct {
+	Name string `mapstructure:"name"`
+	// Frequency is the poll interval in minutes, watch.frequency when unset
+	Frequency int64       `mapstructure:"frequency"`
+	Filter    watchFilter `mapstructure:"filter"`
+	Notifier  string      `mapstructure:"notifier"`
+	// Prepare runs get in the background for the tickets of the view
+	Prepare bool `mapstructure:"prepare"`
+}
+
+// watchFilter narrows the tickets of a view that are notified, a ticket matches when all the set conditions match
+type watchFilter struct {
+	Statuses      []string `mapstructure:"statuses"`
+	Priorities    []string `mapstructure:"priorities"`
+	Tags          []string `mapstructure:"tags"`
+	Organizations []string `mapstructure:"organizations"`
+	Unassigned    bool     `mapstructure:"unassigned"`
+}
+
+// watchedView is a configured view resolved to its zendesk id
+type watchedView struct {
+	watchViewConfig
+	ID       int64
+	notifier notify.Notifier
+	next     time.Time
+
+	// what the last poll found, for the daemon status
+	lastPoll time.Time
+	lastErr  error
+	failures int
+	queue    []watchQueueTicket
+
+	// set in export mode, when the view is followed through the export rather than polled
+	match   viewMatcher
+	tickets map[int64]zdlib.Ticket
+}
+
+func (v *watchedView) frequency() time.Duration {
+	if v.Frequency > 0 {
+		return time.Minute * time.Duration(v.Frequency)
+	}
+
+	return time.Minute * time.Duration(viper.GetInt64("watch.frequency"))
+}
+
+func (f watchFilter) matches(ticket zdlib.Ticket, orgName func(int64) string) bool {
+	if len(f.Statuses) > 0 && !containsString(f.Statuses, ticket.Status) {
+		return false
+	}
+	if len(f.Priorities) > 0 && !containsString(f.Priorities, ticket.Priority) {
+		return false
+	}
+	if f.Unassigned && ticket.AssigneeID != 0 {
+		return false
+	}
+
+	if len(f.Tags) > 0 {
+		found := false
+		for _, tag := range ticket.Tags {
+			if containsString(f.Tags, tag) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(f.Organizations) > 0 && (ticket.OrganizationID == 0 || !containsString(f.Organizations, orgName(ticket.OrganizationID))) {
+		return false
+	}
+
+	return true
+}
+
+// loadWatchViews returns the configured views, or the single watch.view when there are none
+func loadWatchViews() ([]watchViewConfig, error) {
+	configs := []watchViewConfig{}
+	if err := viper.UnmarshalKey("watch.views", &configs); err != nil {
+		return nil, fmt.Errorf("failed to read watch.views: %w", err)
+	}
+
+	if len(configs) == 0 {
+		configs = append(configs, watchViewConfig{Name: viper.GetString("watch.view")})
+	}
+
+	for i := range configs {
+		c := &configs[i]
+		if c.Name == "" {
+			return nil, fmt.Errorf("watch.views entry %d has no name", i+1)
+		}
+		if c.Notifier == "" {
+			c.Notifier = notifierDesktop
+		}
+	}
+
+	return configs, nil
+}
+
+// resolveWatchedViews finds the ids of the configured views, unknown names are an error
+// rather than a watcher silently watching nothing
+func resolveWatchedViews(ctx context.Context, zd zendesk.API, out io.Writer) ([]*watchedView, error) {
+	configs, err := loadWatchViews()
+	if err != nil {
+		return nil, err
+	}
+	notifiers, err := loadNotifiers(out)
+	if err != nil {
+		return nil, err
+	}
+
+	views, err := zd.GetAllViews(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errViewsUnavailable, err)
+	}
+	ids := map[string]int64{}
+	for _, v := range views {
+		ids[v.Title] = v.ID
+	}
+
+	watched := []*watchedView{}
+	unknown := []string{}
+	for _, c := range configs {
+		id, ok := ids[c.Name]
+		if !ok {
+			unknown = append(unknown, fmt.Sprintf("%q", c.Name))
+			continue
+		}
+		n, ok := notifiers[c.Notifier]
+		if !ok {
+			return nil, fmt.Errorf("view %s: unknown notifier %q, it must be desktop, stdout or one of watch.notifiers", c.Name, c.Notifier)
+		}
+		watched = append(watched, &watchedView{watchViewConfig: c, ID: id, notifier: n})
+	}
+
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown views %s, run `supportctl views list` to see the available ones", strings.Join(unknown, ", "))
+	}
+
+	return watched, nil
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/julientant/supportctl/zendesk"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// whoamiCmd represents the whoami command
+var whoamiCmd = &cobra.Command{
+	Use:     "whoami",
+	Short:   "Show the zendesk user the token belongs to",
+	PreRunE: mustHaveZendeskConfig,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		zd, err := newZendeskClient()
+		if err != nil {
+			return fmt.Errorf("failed to create zendesk client: %w", err)
+		}
+
+		user, err := zd.GetCurrentUser(cmd.Context())
+		if zendesk.IsUnauthorized(err) {
+			return errTokenRejected
+		}
+		if err != nil {
+			return fmt.Errorf("failed to retrieve current user: %w", err)
+		}
+
+		groups, err := zd.GetUserGroups(cmd.Context(), user.ID)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve groups: %w", err)
+		}
+		groupNames := []string{}
+		for _, g := range groups {
+			groupNames = append(groupNames, g.Name)
+		}
+
+		scopes, err := zd.GetTokenScopes(cmd.Context())
+		if err != nil {
+			scopes = []string{"unknown"}
+		}
+
+		fmt.Printf("Subdomain: %s\n", viper.GetString("zendesk.subdomain"))
+		fmt.Printf("Name:      %s\n", user.Name)
+		fmt.Printf("Email:     %s\n", user.Email)
+		fmt.Printf("Role:      %s\n", user.Role)
+		fmt.Printf("Groups:    %s\n", strings.Join(groupNames, ", "))
+		fmt.Printf("Scopes:    %s\n", strings.Join(scopes, ", "))
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(whoamiCmd)
+}
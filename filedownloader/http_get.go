@@ -1,39 +1,66 @@
 package filedownloader
 
 import (
+	"errors"
 	"fmt"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
 )
 
+// ErrUnauthorized is returned when the server refuses to hand over the file
+var ErrUnauthorized = errors.New("not allowed to download the file, check your credentials can access it")
+
 type HTTPGetFile struct {
-	URL string
+	URL    string
+	Client *http.Client
 }
 
-func NewHTTPGetFile(url string) *HTTPGetFile {
+// NewHTTPGetFile creates a file downloaded with client, nil uses http.DefaultClient
+func NewHTTPGetFile(url string, client *http.Client) *HTTPGetFile {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
 	return &HTTPGetFile{
-		URL: url,
+		URL:    url,
+		Client: client,
 	}
 }
 
 func (h *HTTPGetFile) Download(to string) error {
-	res, err := http.Get(h.URL)
+	res, err := h.Client.Get(h.URL)
 	if err != nil {
-		return fmt.Errorf("failed to download support packet: %w", err)
+		return fmt.Errorf("failed to download file: %w", err)
 	}
 	defer res.Body.Close()
 
+	switch {
+	case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%w (%s)", ErrUnauthorized, res.Status)
+	case res.StatusCode >= 300:
+		return fmt.Errorf("failed to download file: %s", res.Status)
+	}
+
+	// without valid credentials, private attachments answer with the login page
+	if mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); mediaType == "text/html" && filepath.Ext(to) != ".html" {
+		return fmt.Errorf("%w (got an HTML page instead of the file)", ErrUnauthorized)
+	}
+
 	// create all dirs required for the file
 	err = os.MkdirAll(filepath.Dir(to), os.ModePerm)
 	if err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	file, err := os.Create(to)
+	// download next to the destination so a failed download does not leave a truncated file behind
+	tmp := to + ".part"
+	file, err := os.Create(tmp)
 	if err != nil {
 		return fmt.Errorf("failed to create file: %w", err)
 	}
+	defer os.Remove(tmp)
 	defer file.Close()
 
 	_, err = file.ReadFrom(res.Body)
@@ -41,5 +68,13 @@ func (h *HTTPGetFile) Download(to string) error {
 		return fmt.Errorf("failed to write file: %w", err)
 	}
 
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	if err := os.Rename(tmp, to); err != nil {
+		return fmt.Errorf("failed to move file in place: %w", err)
+	}
+
 	return nil
 }
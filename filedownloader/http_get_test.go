@@ -0,0 +1,53 @@
+package filedownloader
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHTTPGetFileDownload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/packet.zip":
+			w.Header().Set("Content-Type", "application/zip")
+			w.Write([]byte("zip content"))
+		case "/login.zip":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<html>Sign in</html>"))
+		case "/forbidden.zip":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+
+	to := filepath.Join(dir, "nested", "packet.zip")
+	if err := NewHTTPGetFile(server.URL+"/packet.zip", nil).Download(to); err != nil {
+		t.Fatalf("download failed: %s", err)
+	}
+	if b, _ := os.ReadFile(to); string(b) != "zip content" {
+		t.Errorf("unexpected content %q", b)
+	}
+
+	for _, name := range []string{"login.zip", "forbidden.zip"} {
+		to := filepath.Join(dir, name)
+		err := NewHTTPGetFile(server.URL+"/"+name, nil).Download(to)
+		if !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("%s: expected ErrUnauthorized, got %v", name, err)
+		}
+		if _, err := os.Stat(to); !os.IsNotExist(err) {
+			t.Errorf("%s: no file should be written", name)
+		}
+	}
+
+	if err := NewHTTPGetFile(server.URL+"/missing.zip", nil).Download(filepath.Join(dir, "missing.zip")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
@@ -18,3 +18,18 @@ func (c *LibClient) Clone(ctx context.Context, repo, dest string) error {
 	})
 	return err
 }
+
+// Head returns the commit checked out in the repository at dest
+func (c *LibClient) Head(dest string) (string, error) {
+	repo, err := gitlib.PlainOpen(dest)
+	if err != nil {
+		return "", err
+	}
+
+	ref, err := repo.Head()
+	if err != nil {
+		return "", err
+	}
+
+	return ref.Hash().String(), nil
+}
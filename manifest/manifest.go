@@ -0,0 +1,158 @@
+// Package manifest reads and writes the metadata supportctl keeps in each ticket folder,
+// so commands can work with a ticket without asking zendesk.
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// Dir is the folder holding the supportctl files inside a ticket folder
+	Dir      = ".supportctl"
+	fileName = "ticket.json"
+)
+
+type Manifest struct {
+	Ticket        Ticket         `json:"ticket"`
+	Attachments   []Attachment   `json:"attachments"`
+	SupportPacket *SupportPacket `json:"support_packet,omitempty"`
+	Repro         *Repro         `json:"repro,omitempty"`
+	// Stages are the stages of get that ran, with when they last succeeded
+	Stages map[string]time.Time `json:"stages,omitempty"`
+
+	// when the folder was first prepared and last refreshed by get
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Ticket is a snapshot of the zendesk ticket as of the last get
+type Ticket struct {
+	ID               int64      `json:"id"`
+	URL              string     `json:"url,omitempty"`
+	Subject          string     `json:"subject"`
+	Status           string     `json:"status"`
+	Priority         string     `json:"priority,omitempty"`
+	Tags             []string   `json:"tags,omitempty"`
+	RequesterID      int64      `json:"requester_id,omitempty"`
+	RequesterName    string     `json:"requester_name,omitempty"`
+	RequesterEmail   string     `json:"requester_email,omitempty"`
+	OrganizationID   int64      `json:"organization_id,omitempty"`
+	OrganizationName string     `json:"organization_name,omitempty"`
+	AssigneeID       int64      `json:"assignee_id,omitempty"`
+	AssigneeName     string     `json:"assignee_name,omitempty"`
+	CreatedAt        *time.Time `json:"created_at,omitempty"`
+	UpdatedAt        *time.Time `json:"updated_at,omitempty"`
+}
+
+// Attachment is a file downloaded from the ticket
+type Attachment struct {
+	FileName     string    `json:"file_name"`
+	Size         int64     `json:"size"`
+	SHA256       string    `json:"sha256"`
+	DownloadedAt time.Time `json:"downloaded_at"`
+}
+
+// SupportPacket is the summary of the support packet extracted in latest-support-packet
+type SupportPacket struct {
+	FileName           string `json:"file_name"`
+	ServerVersion      string `json:"server_version,omitempty" yaml:"server_version"`
+	ServerOS           string `json:"server_os,omitempty" yaml:"server_os"`
+	ServerArchitecture string `json:"server_architecture,omitempty" yaml:"server_architecture"`
+	BuildHash          string `json:"build_hash,omitempty" yaml:"build_hash"`
+	DatabaseType       string `json:"database_type,omitempty" yaml:"database_type"`
+	DatabaseVersion    string `json:"database_version,omitempty" yaml:"database_version"`
+	LicenseTo          string `json:"license_to,omitempty" yaml:"license_to"`
+	ActiveUsers        int64  `json:"active_users,omitempty" yaml:"active_users"`
+}
+
+// Repro is the CS-Repro-Mattermost clone of the ticket
+type Repro struct {
+	Repository string    `json:"repository"`
+	Commit     string    `json:"commit"`
+	ClonedAt   time.Time `json:"cloned_at"`
+}
+
+// Path returns the location of the manifest of a ticket folder
+func Path(folder string) string {
+	return filepath.Join(folder, Dir, fileName)
+}
+
+// Load reads the manifest of a ticket folder, the error wraps os.ErrNotExist if there is none
+func Load(folder string) (*Manifest, error) {
+	b, err := os.ReadFile(Path(folder))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	m := &Manifest{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+
+	return m, nil
+}
+
+// Save writes the manifest in the ticket folder
+func Save(folder string, m *Manifest) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	path := Path(folder)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create manifest folder: %w", err)
+	}
+
+	// write then rename so readers never see a partial manifest
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	return nil
+}
+
+// SetAttachment records a downloaded file, replacing a previous download of the same name
+func (m *Manifest) SetAttachment(a Attachment) {
+	for i := range m.Attachments {
+		if m.Attachments[i].FileName == a.FileName {
+			m.Attachments[i] = a
+			return
+		}
+	}
+
+	m.Attachments = append(m.Attachments, a)
+}
+
+// NewAttachment describes the downloaded file at path
+func NewAttachment(path string) (Attachment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("failed to hash file: %w", err)
+	}
+
+	return Attachment{
+		FileName:     filepath.Base(path),
+		Size:         size,
+		SHA256:       hex.EncodeToString(h.Sum(nil)),
+		DownloadedAt: time.Now(),
+	}, nil
+}
@@ -0,0 +1,35 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+// Command runs a program for every event, with the event as JSON on its stdin
+type Command struct {
+	// Args is the program and its arguments, no shell is involved
+	Args []string
+}
+
+func (c *Command) Notify(ctx context.Context, e Event) error {
+	if len(c.Args) == 0 {
+		return errors.New("no command to run")
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, c.Args[0], c.Args[1:]...)
+	cmd.Stdin = bytes.NewReader(b)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", c.Args[0], err, bytes.TrimSpace(out))
+	}
+
+	return nil
+}
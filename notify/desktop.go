@@ -0,0 +1,19 @@
+package notify
+
+import "context"
+
+// Desktop shows the events as desktop notifications, with a sound unless their urgency is low
+type Desktop struct {
+	// Alert shows the notification with a sound, like beeep.Alert
+	Alert func(title, message, appIcon string) error
+	// Quiet shows the notification silently, like beeep.Notify
+	Quiet func(title, message, appIcon string) error
+}
+
+func (d *Desktop) Notify(_ context.Context, e Event) error {
+	if e.Urgency == UrgencyLow && d.Quiet != nil {
+		return d.Quiet(e.Title, e.Message, "")
+	}
+
+	return d.Alert(e.Title, e.Message, "")
+}
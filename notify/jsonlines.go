@@ -0,0 +1,22 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// JSONLines writes every event as a line of JSON, to pipe the watcher into other tools
+type JSONLines struct {
+	W io.Writer
+
+	mu sync.Mutex
+}
+
+func (j *JSONLines) Notify(_ context.Context, e Event) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return json.NewEncoder(j.W).Encode(e)
+}
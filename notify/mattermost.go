@@ -0,0 +1,74 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Mattermost posts the events in a channel through an incoming webhook
+type Mattermost struct {
+	WebhookURL string
+	// Channel, Username and IconURL override the webhook defaults when set
+	Channel  string
+	Username string
+	IconURL  string
+	// Mention is prepended to the high urgency notifications, like @here
+	Mention string
+
+	Client *http.Client
+}
+
+type mattermostPayload struct {
+	Text     string `json:"text"`
+	Channel  string `json:"channel,omitempty"`
+	Username string `json:"username,omitempty"`
+	IconURL  string `json:"icon_url,omitempty"`
+}
+
+func (m *Mattermost) Notify(ctx context.Context, e Event) error {
+	text := fmt.Sprintf("#### [%s](%s)\n%s", e.Title, e.URL, e.Message)
+	if e.Urgency == UrgencyHigh {
+		text = fmt.Sprintf("#### :rotating_light: [%s](%s)\n%s", e.Title, e.URL, e.Message)
+		if m.Mention != "" {
+			text += "\n" + m.Mention
+		}
+	}
+
+	b, err := json.Marshal(mattermostPayload{
+		Text:     text,
+		Channel:  m.Channel,
+		Username: m.Username,
+		IconURL:  m.IconURL,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.WebhookURL, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := m.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post to mattermost: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("mattermost webhook answered %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+// Package notify sends the notifications of the watcher to the desktop, chat or other programs.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"text/template"
+	"time"
+
+	"github.com/nukosuke/go-zendesk/zendesk"
+)
+
+// Kinds of events
+const (
+	KindNew        = "new"
+	KindUnassigned = "unassigned"
+	KindSLA        = "sla"
+	// KindDigest gathers the events held back outside working hours, in Events
+	KindDigest = "digest"
+)
+
+// Urgencies of events, notifiers make the urgent ones harder to miss
+const (
+	UrgencyLow    = "low"
+	UrgencyNormal = "normal"
+	UrgencyHigh   = "high"
+)
+
+// DefaultTitle and DefaultMessage are the templates used when a notifier does not set its own
+const (
+	DefaultTitle = `{{if eq .Kind "digest"}}{{len .Events}} notifications while you were away` +
+		`{{else if eq .Kind "unassigned"}}Ticket #{{.Ticket.ID}} unassigned for {{.UnassignedFor}}` +
+		`{{else if eq .Kind "sla"}}{{if .SLA.Breached}}SLA breached{{else}}SLA breach in {{.SLA.Remaining}}{{end}} on ticket #{{.Ticket.ID}}` +
+		`{{else}}New ticket #{{.Ticket.ID}}{{end}}`
+	DefaultMessage = `{{define "event"}}{{with .SLA}}{{.Metric}}: {{end}}{{.Ticket.Subject}}{{with .Organization}} ({{.}}){{end}}{{end}}` +
+		`{{if eq .Kind "digest"}}{{range $i, $e := .Events}}{{if $i}}{{"\n"}}{{end}}#{{$e.Ticket.ID}} {{template "event" $e}}{{end}}` +
+		`{{else}}{{template "event" .}}{{end}}`
+)
+
+// Event is a ticket the watcher notifies about
+type Event struct {
+	Kind         string         `json:"kind"`
+	View         string         `json:"view"`
+	Ticket       zendesk.Ticket `json:"ticket"`
+	Organization string         `json:"organization,omitempty"`
+	URL          string         `json:"url"`
+	FirstSeen    time.Time      `json:"first_seen"`
+	Urgency      string         `json:"urgency"`
+	SLA          *SLAWarning    `json:"sla,omitempty"`
+	// Events are the events of a digest
+	Events []Event `json:"events,omitempty"`
+
+	// Title and Message are rendered from the templates of the notifier
+	Title   string `json:"title"`
+	Message string `json:"message"`
+}
+
+// SLAWarning is an SLA target the ticket is about to miss, or missed
+type SLAWarning struct {
+	Metric   string    `json:"metric"`
+	BreachAt time.Time `json:"breach_at"`
+	// Level is how close the breach is, like warning, critical or breached
+	Level string `json:"level"`
+}
+
+// Remaining is the time left before the breach, rounded to the minute
+func (w SLAWarning) Remaining() time.Duration {
+	return time.Until(w.BreachAt).Round(time.Minute)
+}
+
+// Breached reports whether the target was missed
+func (w SLAWarning) Breached() bool {
+	return !time.Now().Before(w.BreachAt)
+}
+
+// UnassignedFor is how long the ticket has been waiting in the view, rounded to the minute
+func (e Event) UnassignedFor() time.Duration {
+	return time.Since(e.FirstSeen).Round(time.Minute)
+}
+
+// Notifier sends notifications somewhere
+type Notifier interface {
+	Notify(ctx context.Context, e Event) error
+}
+
+// Template renders the title and message of events
+type Template struct {
+	title   *template.Template
+	message *template.Template
+}
+
+// NewTemplate parses the title and message templates, empty ones are the defaults
+func NewTemplate(title, message string) (*Template, error) {
+	if title == "" {
+		title = DefaultTitle
+	}
+	if message == "" {
+		message = DefaultMessage
+	}
+
+	t := &Template{}
+	var err error
+	if t.title, err = template.New("title").Parse(title); err != nil {
+		return nil, fmt.Errorf("invalid title template: %w", err)
+	}
+	if t.message, err = template.New("message").Parse(message); err != nil {
+		return nil, fmt.Errorf("invalid message template: %w", err)
+	}
+
+	return t, nil
+}
+
+// Render sets the title and message of the event
+func (t *Template) Render(e *Event) error {
+	var buf bytes.Buffer
+	if err := t.title.Execute(&buf, e); err != nil {
+		return fmt.Errorf("failed to render title: %w", err)
+	}
+	e.Title = buf.String()
+
+	buf.Reset()
+	if err := t.message.Execute(&buf, e); err != nil {
+		return fmt.Errorf("failed to render message: %w", err)
+	}
+	e.Message = buf.String()
+
+	return nil
+}
+
+type templated struct {
+	Notifier
+	template *Template
+}
+
+// Templated renders the events with the template before handing them to the notifier
+func Templated(n Notifier, t *Template) Notifier {
+	return &templated{Notifier: n, template: t}
+}
+
+func (t *templated) Notify(ctx context.Context, e Event) error {
+	if err := t.template.Render(&e); err != nil {
+		return err
+	}
+
+	return t.Notifier.Notify(ctx, e)
+}
@@ -0,0 +1,181 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nukosuke/go-zendesk/zendesk"
+)
+
+func TestTemplate(t *testing.T) {
+	def, err := NewTemplate("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := Event{
+		Kind:         KindUnassigned,
+		Ticket:       zendesk.Ticket{ID: 42, Subject: "Server crashes"},
+		Organization: "Acme Corp",
+		FirstSeen:    time.Now().Add(-90 * time.Minute),
+	}
+	if err := def.Render(&e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Title != "Ticket #42 unassigned for 1h30m0s" || e.Message != "Server crashes (Acme Corp)" {
+		t.Errorf("unexpected default rendering %q / %q", e.Title, e.Message)
+	}
+
+	custom, err := NewTemplate("{{.View}}: #{{.Ticket.ID}}", "{{.Ticket.Subject | printf \"%.6s\"}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.View = "Urgent"
+	if err := custom.Render(&e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Title != "Urgent: #42" || e.Message != "Server" {
+		t.Errorf("unexpected custom rendering %q / %q", e.Title, e.Message)
+	}
+
+	if _, err := NewTemplate("{{.Nope", ""); err == nil {
+		t.Error("invalid template should be rejected")
+	}
+}
+
+func TestMattermost(t *testing.T) {
+	var got mattermostPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("invalid payload: %s", err)
+		}
+	}))
+	defer server.Close()
+
+	m := &Mattermost{WebhookURL: server.URL, Channel: "support"}
+	err := m.Notify(context.Background(), Event{
+		Title:   "New ticket #42",
+		Message: "Server crashes",
+		URL:     "https://acme.zendesk.com/agent/tickets/42",
+	})
+	if err != nil {
+		t.Fatalf("notify failed: %s", err)
+	}
+
+	if got.Channel != "support" || got.Text != "#### [New ticket #42](https://acme.zendesk.com/agent/tickets/42)\nServer crashes" {
+		t.Errorf("unexpected payload %+v", got)
+	}
+}
+
+func TestMattermostError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid webhook", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	err := (&Mattermost{WebhookURL: server.URL}).Notify(context.Background(), Event{})
+	if err == nil || !strings.Contains(err.Error(), "invalid webhook") {
+		t.Errorf("webhook errors should be reported, got %v", err)
+	}
+}
+
+type recorder struct {
+	events []Event
+}
+
+func (r *recorder) Notify(_ context.Context, e Event) error {
+	r.events = append(r.events, e)
+	return nil
+}
+
+func TestSchedule(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("no timezone database:", err)
+	}
+	hours, err := ParseWorkingHours("09:00-18:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Schedule{
+		Location: paris,
+		Hours:    map[time.Weekday]WorkingHours{time.Monday: hours},
+		Holidays: map[string]bool{"2024-12-30": true},
+	}
+
+	tests := []struct {
+		at   time.Time
+		want bool
+	}{
+		{time.Date(2024, 12, 23, 9, 0, 0, 0, paris), true},
+		{time.Date(2024, 12, 23, 17, 59, 0, 0, paris), true},
+		{time.Date(2024, 12, 23, 18, 0, 0, 0, paris), false},
+		// 08:30 UTC is 09:30 in Paris
+		{time.Date(2024, 12, 23, 8, 30, 0, 0, time.UTC), true},
+		{time.Date(2024, 12, 24, 10, 0, 0, 0, paris), false},
+		{time.Date(2024, 12, 30, 10, 0, 0, 0, paris), false},
+	}
+	for _, tt := range tests {
+		if got := s.Working(tt.at); got != tt.want {
+			t.Errorf("Working(%s) = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+
+	for _, invalid := range []string{"9-18", "18:00-09:00", "09:00-25:00", "09:00"} {
+		if _, err := ParseWorkingHours(invalid); err == nil {
+			t.Errorf("%q should be invalid", invalid)
+		}
+	}
+}
+
+func TestScheduledDigest(t *testing.T) {
+	hours, _ := ParseWorkingHours("09:00-18:00")
+	now := time.Date(2024, 12, 23, 7, 0, 0, 0, time.UTC)
+	r := &recorder{}
+	def, err := NewTemplate("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Scheduled{
+		Notifier: Templated(r, def),
+		Schedule: &Schedule{Location: time.UTC, Hours: map[time.Weekday]WorkingHours{time.Monday: hours}},
+		Digest:   true,
+		Now:      func() time.Time { return now },
+	}
+
+	ctx := context.Background()
+	s.Notify(ctx, Event{Kind: KindNew, Ticket: zendesk.Ticket{ID: 1, Subject: "First"}, Urgency: UrgencyNormal})
+	s.Notify(ctx, Event{Kind: KindNew, Ticket: zendesk.Ticket{ID: 2, Subject: "Second"}, Organization: "Acme", Urgency: UrgencyHigh})
+	if err := s.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.events) != 0 || len(s.Held()) != 2 {
+		t.Fatalf("events outside hours should be held, got %d sent and %d held", len(r.events), len(s.Held()))
+	}
+
+	now = now.Add(2 * time.Hour)
+	if err := s.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.events) != 1 || len(s.Held()) != 0 {
+		t.Fatalf("expected a digest, got %d sent and %d held", len(r.events), len(s.Held()))
+	}
+	digest := r.events[0]
+	if digest.Kind != KindDigest || digest.Urgency != UrgencyHigh {
+		t.Errorf("unexpected digest %+v", digest)
+	}
+	if digest.Title != "2 notifications while you were away" || digest.Message != "#1 First\n#2 Second (Acme)" {
+		t.Errorf("unexpected digest rendering %q / %q", digest.Title, digest.Message)
+	}
+
+	// in working hours, events go through
+	s.Notify(ctx, Event{Kind: KindNew, Ticket: zendesk.Ticket{ID: 3, Subject: "Third"}})
+	if len(r.events) != 2 || r.events[1].Title != "New ticket #3" {
+		t.Errorf("events in working hours should be sent, got %+v", r.events)
+	}
+}
@@ -0,0 +1,179 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const holidayFormat = "2006-01-02"
+
+// WorkingHours is a shift within a day, as durations since midnight
+type WorkingHours struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// ParseWorkingHours parses a shift like 09:00-18:00, the end can be 24:00
+func ParseWorkingHours(s string) (WorkingHours, error) {
+	start, end, ok := strings.Cut(s, "-")
+	if !ok {
+		return WorkingHours{}, fmt.Errorf("invalid working hours %q, expected a range like 09:00-18:00", s)
+	}
+
+	h := WorkingHours{}
+	var err error
+	if h.Start, err = parseClock(start); err != nil {
+		return WorkingHours{}, err
+	}
+	if h.End, err = parseClock(end); err != nil {
+		return WorkingHours{}, err
+	}
+	if h.End <= h.Start {
+		return WorkingHours{}, fmt.Errorf("invalid working hours %q, the end must be after the start", s)
+	}
+
+	return h, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	var hours, minutes int
+	if _, err := fmt.Sscanf(strings.TrimSpace(s), "%d:%d", &hours, &minutes); err != nil || hours < 0 || minutes < 0 || minutes > 59 || hours*60+minutes > 24*60 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, nil
+}
+
+// Schedule is when someone is at work to receive notifications
+type Schedule struct {
+	Location *time.Location
+	// Hours are the working hours by weekday, the days missing are off
+	Hours map[time.Weekday]WorkingHours
+	// Holidays are days off, formatted as 2006-01-02
+	Holidays map[string]bool
+}
+
+// Working reports whether t is within the working hours
+func (s *Schedule) Working(t time.Time) bool {
+	t = t.In(s.Location)
+	if s.Holidays[t.Format(holidayFormat)] {
+		return false
+	}
+
+	h, ok := s.Hours[t.Weekday()]
+	if !ok {
+		return false
+	}
+	sinceMidnight := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+
+	return sinceMidnight >= h.Start && sinceMidnight < h.End
+}
+
+// LoadHolidays reads a file listing a day per line, formatted as 2006-01-02.
+// The rest of the line and the lines starting with # are ignored.
+func LoadHolidays(path string) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open holidays file: %w", err)
+	}
+	defer f.Close()
+
+	holidays := map[string]bool{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if _, err := time.Parse(holidayFormat, fields[0]); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid day %q, expected YYYY-MM-DD", path, line, fields[0])
+		}
+		holidays[fields[0]] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read holidays file: %w", err)
+	}
+
+	return holidays, nil
+}
+
+// Scheduled holds back the events outside the working hours of the schedule.
+// With Digest, they are sent together by Flush once the shift starts, otherwise they are dropped.
+type Scheduled struct {
+	Notifier Notifier
+	Schedule *Schedule
+	Digest   bool
+	// Now is the clock, time.Now when nil
+	Now func() time.Time
+
+	mu   sync.Mutex
+	held []Event
+}
+
+func (s *Scheduled) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+
+	return time.Now()
+}
+
+func (s *Scheduled) Notify(ctx context.Context, e Event) error {
+	if s.Schedule.Working(s.now()) {
+		return s.Notifier.Notify(ctx, e)
+	}
+
+	if s.Digest {
+		s.mu.Lock()
+		s.held = append(s.held, e)
+		s.mu.Unlock()
+	}
+
+	return nil
+}
+
+// Flush sends the events held back in a digest when it is working time
+func (s *Scheduled) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.held) == 0 || !s.Schedule.Working(s.now()) {
+		return nil
+	}
+
+	digest := Event{Kind: KindDigest, Urgency: UrgencyLow, Events: s.held}
+	for _, e := range s.held {
+		if urgencyRank[e.Urgency] > urgencyRank[digest.Urgency] {
+			digest.Urgency = e.Urgency
+		}
+	}
+	if err := s.Notifier.Notify(ctx, digest); err != nil {
+		return err
+	}
+	s.held = nil
+
+	return nil
+}
+
+// Held returns the events waiting for the digest
+func (s *Scheduled) Held() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Event{}, s.held...)
+}
+
+// Hold adds events to the digest, like the ones held before a restart
+func (s *Scheduled) Hold(events ...Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.held = append(s.held, events...)
+}
+
+var urgencyRank = map[string]int{UrgencyLow: 0, UrgencyNormal: 1, UrgencyHigh: 2}
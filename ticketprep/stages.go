@@ -0,0 +1,270 @@
+package ticketprep
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julientant/supportctl/filedownloader"
+	"github.com/julientant/supportctl/manifest"
+	zdlib "github.com/nukosuke/go-zendesk/zendesk"
+	"gopkg.in/yaml.v3"
+)
+
+// DownloadAttachments downloads the latest support packet of the ticket, or all its attachments with AllAttachments
+func (pr *Preparer) DownloadAttachments(ctx context.Context, p *Prep) error {
+	if err := os.MkdirAll(p.Folder, 0755); err != nil {
+		return fmt.Errorf("failed to create ticket folder: %w", err)
+	}
+
+	// check the ticket for support packet
+	toDownloadFilesNames := []string{}
+	toDownloadedMap := map[string]string{}
+	commentQuery := &zdlib.ListTicketCommentsOptions{
+		CursorPagination: zdlib.CursorPagination{
+			PageSize:  100,
+			PageAfter: "",
+		},
+	}
+	for {
+		commentsRes, err := pr.ZD.ListTicketComments(ctx, p.TicketID, commentQuery)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve ticket comments: %w", err)
+		}
+		for _, comment := range commentsRes.TicketComments {
+			for _, a := range comment.Attachments {
+				if pr.AllAttachments || SupportPacketRegex.MatchString(a.FileName) {
+					if _, ok := toDownloadedMap[a.FileName]; ok {
+						continue
+					}
+					toDownloadFilesNames = append(toDownloadFilesNames, a.FileName)
+					toDownloadedMap[a.FileName] = a.ContentURL
+				}
+			}
+		}
+		if !commentsRes.Meta.HasMore {
+			break
+		}
+		pr.logf("Going for the next page")
+		commentQuery.PageAfter = commentsRes.Meta.AfterCursor
+	}
+
+	// the support packet file names hold their date, so sorting them by name descending puts the latest first
+	sort.Slice(toDownloadFilesNames, func(i, j int) bool {
+		return toDownloadFilesNames[i] > toDownloadFilesNames[j]
+	})
+
+	latestSupportPacket := ""
+	for _, fileName := range toDownloadFilesNames {
+		pr.logf("Downloading attachment %s to %s", fileName, p.Folder)
+
+		var f filedownloader.File
+		// for now we only support http get file
+		f = filedownloader.NewHTTPGetFile(toDownloadedMap[fileName], pr.ZD.AttachmentClient())
+		filePath := filepath.Join(p.Folder, fileName)
+		if err := f.Download(filePath); err != nil {
+			return fmt.Errorf("failed to download %s: %w", fileName, err)
+		}
+
+		attachment, err := manifest.NewAttachment(filePath)
+		if err != nil {
+			return fmt.Errorf("failed to describe %s: %w", fileName, err)
+		}
+		p.Manifest.SetAttachment(attachment)
+
+		if latestSupportPacket == "" && SupportPacketRegex.MatchString(fileName) {
+			latestSupportPacket = fileName
+		}
+		if latestSupportPacket != "" && !pr.AllAttachments {
+			break
+		}
+	}
+	if latestSupportPacket != "" {
+		p.LatestSupportPacket = latestSupportPacket
+	}
+
+	return nil
+}
+
+// CloneRepro clones CS-Repro-Mattermost in the ticket folder and renames its containers
+// after the ticket, an existing clone is left untouched
+func (pr *Preparer) CloneRepro(ctx context.Context, p *Prep) error {
+	dest := filepath.Join(p.Folder, ReproDir)
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		return nil
+	}
+
+	pr.logf("Cloning CS-Repro-Mattermost")
+	if err := pr.Git.Clone(ctx, pr.ReproRepository, dest); err != nil {
+		return fmt.Errorf("failed to clone repo: %w", err)
+	}
+
+	pr.logf("Renaming containers to add ticket number")
+	if err := pr.replaceInFolder(dest, "cs-repro-", "cs-repro-"+strconv.FormatInt(p.TicketID, 10)+"-"); err != nil {
+		return fmt.Errorf("failed to replace in folder: %w", err)
+	}
+
+	commit, err := pr.Git.Head(dest)
+	if err != nil {
+		return fmt.Errorf("failed to get cloned commit: %w", err)
+	}
+	p.Manifest.Repro = &manifest.Repro{
+		Repository: pr.ReproRepository,
+		Commit:     commit,
+		ClonedAt:   time.Now(),
+	}
+
+	return nil
+}
+
+// ExtractSupportPacket unzips the latest support packet in latest-support-packet, replacing
+// a previous extraction, and records its summary in the manifest. It does nothing without support packet.
+func (pr *Preparer) ExtractSupportPacket(_ context.Context, p *Prep) error {
+	if p.LatestSupportPacket == "" {
+		return nil
+	}
+	pr.logf("Support packet found")
+
+	// removing existing latest-support-packet folder
+	dir := filepath.Join(p.Folder, SupportPacketDir)
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		pr.logf("Removing %s", dir)
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("failed to remove latest-support-packet folder: %w", err)
+		}
+	}
+
+	pr.logf("Unzipping %s", p.LatestSupportPacket)
+	if err := unzip(filepath.Join(p.Folder, p.LatestSupportPacket), dir); err != nil {
+		return err
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "support_packet.yaml"))
+	if err != nil {
+		return fmt.Errorf("failed to read support_packet.yaml: %w", err)
+	}
+	var sp manifest.SupportPacket
+	if err := yaml.Unmarshal(b, &sp); err != nil {
+		return fmt.Errorf("failed to unmarshal support_packet.yaml: %w", err)
+	}
+	sp.FileName = p.LatestSupportPacket
+	p.Manifest.SupportPacket = &sp
+
+	return nil
+}
+
+func unzip(file, dir string) error {
+	archive, err := zip.OpenReader(file)
+	if err != nil {
+		return fmt.Errorf("failed to open zip file: %w", err)
+	}
+	defer archive.Close()
+
+	for _, f := range archive.File {
+		filePath := filepath.Join(dir, filepath.FromSlash(f.Name))
+		if !strings.HasPrefix(filePath, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid path in zip file: %s", f.Name)
+		}
+
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(filePath, os.ModePerm); err != nil {
+				return fmt.Errorf("failed to create directory: %w", err)
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+
+		outFile, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
+		if err != nil {
+			return fmt.Errorf("failed to open file: %w", err)
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			outFile.Close()
+			return fmt.Errorf("failed to open file in archive: %w", err)
+		}
+
+		_, err = io.Copy(outFile, rc)
+		outFile.Close()
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("failed to copy file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// RewriteCompose names the docker compose project of the repro after the ticket and
+// sets the mattermost image to the version of the extracted support packet
+func (pr *Preparer) RewriteCompose(_ context.Context, p *Prep) error {
+	composePath := filepath.Join(p.Folder, ReproDir, "docker-compose.yml")
+	b, err := os.ReadFile(composePath)
+	if err != nil {
+		return fmt.Errorf("failed to read docker-compose.yml: %w", err)
+	}
+
+	compose := map[string]any{}
+	if err := yaml.Unmarshal(b, &compose); err != nil {
+		return fmt.Errorf("failed to unmarshal docker-compose.yml: %w", err)
+	}
+	compose["name"] = "cs-repro-" + strconv.FormatInt(p.TicketID, 10)
+	if sp := p.Manifest.SupportPacket; sp != nil && sp.ServerVersion != "" {
+		services, _ := compose["services"].(map[string]any)
+		mattermost, ok := services["mattermost"].(map[string]any)
+		if !ok {
+			return fmt.Errorf("docker-compose.yml has no mattermost service")
+		}
+		mattermost["image"] = fmt.Sprintf("mattermost/mattermost-enterprise-edition:%s", sp.ServerVersion)
+	}
+
+	b, err = yaml.Marshal(compose)
+	if err != nil {
+		return fmt.Errorf("failed to marshal docker-compose.yml: %w", err)
+	}
+	if err := os.WriteFile(composePath, b, 0644); err != nil {
+		return fmt.Errorf("failed to write docker-compose.yml: %w", err)
+	}
+
+	return nil
+}
+
+func (pr *Preparer) replaceInFolder(rootPath, oldStr, newStr string) error {
+	return filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			return pr.replaceInFile(path, oldStr, newStr)
+		}
+
+		return nil
+	})
+}
+
+func (pr *Preparer) replaceInFile(filename, oldStr, newStr string) error {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	newContent := strings.ReplaceAll(string(content), oldStr, newStr)
+	if newContent == string(content) {
+		return nil
+	}
+	pr.logf("Replacing in %s", filename)
+
+	return os.WriteFile(filename, []byte(newContent), os.ModePerm)
+}
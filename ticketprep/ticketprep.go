@@ -0,0 +1,277 @@
+// Package ticketprep makes the local environment of a ticket, the way get does.
+//
+// The preparation is split into stages that run in order. Each stage records what it
+// did in the manifest of the ticket folder, so a stage can run again on its own later,
+// like extracting the support packet again without downloading it.
+package ticketprep
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/julientant/supportctl/manifest"
+	"github.com/julientant/supportctl/zendesk"
+	zdlib "github.com/nukosuke/go-zendesk/zendesk"
+)
+
+// Stages of the preparation, in the order they run
+const (
+	// StageTicket snapshots the ticket in the manifest
+	StageTicket = "ticket"
+	// StageAttachments downloads the latest support packet, or all the attachments
+	StageAttachments = "attachments"
+	// StageRepro clones CS-Repro-Mattermost with containers named after the ticket
+	StageRepro = "repro"
+	// StageSupportPacket extracts the latest support packet in latest-support-packet
+	StageSupportPacket = "support-packet"
+	// StageCompose points the docker compose project of the repro to the version of the support packet
+	StageCompose = "compose"
+)
+
+// Stages lists all the stages in the order they run
+var Stages = []string{StageTicket, StageAttachments, StageRepro, StageSupportPacket, StageCompose}
+
+// SupportPacketRegex matches the file names of the support packets
+var SupportPacketRegex = regexp.MustCompile(`mattermost_support_packet_\d{4}-\d{2}-\d{2}-\d{2}-\d{2}.zip`)
+
+// Folder names inside the ticket folder
+const (
+	ReproDir         = "cs-repro"
+	SupportPacketDir = "latest-support-packet"
+)
+
+// Cloner clones git repositories, like git.LibClient
+type Cloner interface {
+	Clone(ctx context.Context, repo, dest string) error
+	Head(dest string) (string, error)
+}
+
+// Hooks are called around each stage. An error from Before stops the preparation
+// before the stage runs, After sees the error of the stage, if any.
+type Hooks struct {
+	Before func(ctx context.Context, stage string, p *Prep) error
+	After  func(ctx context.Context, stage string, p *Prep, err error)
+}
+
+// Preparer runs the stages
+type Preparer struct {
+	ZD  zendesk.API
+	Git Cloner
+	// AllAttachments downloads all the attachments instead of the latest support packet
+	AllAttachments bool
+	// ReproRepository is the CS-Repro-Mattermost repository to clone
+	ReproRepository string
+	Hooks           Hooks
+	// Logf reports the progress, log.Printf when nil
+	Logf func(format string, args ...any)
+}
+
+// Prep is the preparation of a ticket, shared by its stages
+type Prep struct {
+	TicketID int64
+	Folder   string
+	Manifest *manifest.Manifest
+	// LatestSupportPacket is the file name of the latest support packet in the folder, empty if there is none
+	LatestSupportPacket string
+}
+
+// NewPrep starts the preparation of a ticket in folder, from its manifest when it has been prepared before
+func NewPrep(ticketID int64, folder string) *Prep {
+	m, err := manifest.Load(folder)
+	if err != nil {
+		m = &manifest.Manifest{CreatedAt: time.Now()}
+	}
+
+	p := &Prep{TicketID: ticketID, Folder: folder, Manifest: m}
+	// the support packets downloaded by a previous run, still in the folder
+	for _, a := range m.Attachments {
+		if !SupportPacketRegex.MatchString(a.FileName) || a.FileName <= p.LatestSupportPacket {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(folder, a.FileName)); err == nil {
+			p.LatestSupportPacket = a.FileName
+		}
+	}
+
+	return p
+}
+
+// ParseStages checks the stage names
+func ParseStages(names []string) ([]string, error) {
+	for _, name := range names {
+		if !slices.Contains(Stages, name) {
+			return nil, fmt.Errorf("unknown stage %q, it must be one of %s", name, strings.Join(Stages, ", "))
+		}
+	}
+
+	return names, nil
+}
+
+// SelectStages returns the stages to run, only the ones of only when set, or all but the ones of skip
+func SelectStages(only, skip []string) ([]string, error) {
+	if len(only) > 0 && len(skip) > 0 {
+		return nil, fmt.Errorf("only and skip cannot be used together")
+	}
+	if _, err := ParseStages(append(append([]string{}, only...), skip...)); err != nil {
+		return nil, err
+	}
+
+	stages := []string{}
+	for _, stage := range Stages {
+		if (len(only) == 0 || slices.Contains(only, stage)) && !slices.Contains(skip, stage) {
+			stages = append(stages, stage)
+		}
+	}
+
+	return stages, nil
+}
+
+func (pr *Preparer) logf(format string, args ...any) {
+	if pr.Logf != nil {
+		pr.Logf(format, args...)
+		return
+	}
+
+	log.Printf(format, args...)
+}
+
+// Prepared reports whether all the stages ran on the ticket of the manifest
+func Prepared(m *manifest.Manifest) bool {
+	for _, stage := range Stages {
+		if _, ok := m.Stages[stage]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Run runs the stages on the ticket, in their usual order whatever the order given,
+// and saves the manifest of the folder with the stages that ran
+func (pr *Preparer) Run(ctx context.Context, p *Prep, stages []string) error {
+	if _, err := ParseStages(stages); err != nil {
+		return err
+	}
+
+	for _, stage := range Stages {
+		if !slices.Contains(stages, stage) {
+			continue
+		}
+		if err := pr.RunStage(ctx, p, stage); err != nil {
+			return err
+		}
+		if p.Manifest.Stages == nil {
+			p.Manifest.Stages = map[string]time.Time{}
+		}
+		p.Manifest.Stages[stage] = time.Now()
+	}
+
+	if err := os.MkdirAll(p.Folder, 0755); err != nil {
+		return fmt.Errorf("failed to create ticket folder: %w", err)
+	}
+	p.Manifest.UpdatedAt = time.Now()
+	if err := manifest.Save(p.Folder, p.Manifest); err != nil {
+		return fmt.Errorf("failed to save ticket manifest: %w", err)
+	}
+
+	return nil
+}
+
+// RunStage runs a single stage with its hooks, the manifest is not saved
+func (pr *Preparer) RunStage(ctx context.Context, p *Prep, stage string) error {
+	var run func(context.Context, *Prep) error
+	switch stage {
+	case StageTicket:
+		run = pr.SnapshotTicket
+	case StageAttachments:
+		run = pr.DownloadAttachments
+	case StageRepro:
+		run = pr.CloneRepro
+	case StageSupportPacket:
+		run = pr.ExtractSupportPacket
+	case StageCompose:
+		run = pr.RewriteCompose
+	default:
+		return fmt.Errorf("unknown stage %q", stage)
+	}
+
+	if pr.Hooks.Before != nil {
+		if err := pr.Hooks.Before(ctx, stage, p); err != nil {
+			return err
+		}
+	}
+	err := run(ctx, p)
+	if pr.Hooks.After != nil {
+		pr.Hooks.After(ctx, stage, p, err)
+	}
+
+	return err
+}
+
+// SnapshotTicket records the ticket in the manifest, it fails when the ticket cannot be found
+func (pr *Preparer) SnapshotTicket(ctx context.Context, p *Prep) error {
+	ticket, err := pr.ZD.GetTicket(ctx, p.TicketID)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve ticket: %w", err)
+	}
+	pr.logf("Found ticket: %s", ticket.Subject)
+
+	if err := os.MkdirAll(p.Folder, 0755); err != nil {
+		return fmt.Errorf("failed to create ticket folder: %w", err)
+	}
+	p.Manifest.Ticket = ticketManifest(ctx, pr.ZD, ticket, pr.logf)
+
+	return nil
+}
+
+// ticketManifest snapshots the ticket, resolving the people and organization names.
+// Names are a nice to have, failing to resolve them does not fail the stage.
+func ticketManifest(ctx context.Context, zd zendesk.API, ticket zdlib.Ticket, logf func(string, ...any)) manifest.Ticket {
+	t := manifest.Ticket{
+		ID:             ticket.ID,
+		URL:            ticket.URL,
+		Subject:        ticket.Subject,
+		Status:         ticket.Status,
+		Priority:       ticket.Priority,
+		Tags:           ticket.Tags,
+		RequesterID:    ticket.RequesterID,
+		OrganizationID: ticket.OrganizationID,
+		AssigneeID:     ticket.AssigneeID,
+		CreatedAt:      ticket.CreatedAt,
+		UpdatedAt:      ticket.UpdatedAt,
+	}
+
+	if ticket.RequesterID != 0 {
+		requester, err := zd.GetUser(ctx, ticket.RequesterID)
+		if err != nil {
+			logf("Failed to retrieve requester: %s", err)
+		}
+		t.RequesterName = requester.Name
+		t.RequesterEmail = requester.Email
+	}
+
+	if ticket.AssigneeID != 0 {
+		assignee, err := zd.GetUser(ctx, ticket.AssigneeID)
+		if err != nil {
+			logf("Failed to retrieve assignee: %s", err)
+		}
+		t.AssigneeName = assignee.Name
+	}
+
+	if ticket.OrganizationID != 0 {
+		org, err := zd.GetOrganization(ctx, ticket.OrganizationID)
+		if err != nil {
+			logf("Failed to retrieve organization: %s", err)
+		}
+		t.OrganizationName = org.Name
+	}
+
+	return t
+}
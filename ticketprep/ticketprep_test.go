@@ -0,0 +1,245 @@
+package ticketprep
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/julientant/supportctl/manifest"
+	"github.com/julientant/supportctl/zendesk"
+	"github.com/julientant/supportctl/zendesk/zendesktest"
+	zdlib "github.com/nukosuke/go-zendesk/zendesk"
+)
+
+const testDockerCompose = `services:
+  mattermost:
+    container_name: cs-repro-mattermost
+    image: mattermost/mattermost-enterprise-edition:latest
+`
+
+// fakeCloner stands in for git, the clone is a docker-compose.yml
+type fakeCloner struct {
+	clones int
+}
+
+func (c *fakeCloner) Clone(_ context.Context, _, dest string) error {
+	c.clones++
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dest, "docker-compose.yml"), []byte(testDockerCompose), 0644)
+}
+
+func (c *fakeCloner) Head(string) (string, error) {
+	return "0123abcd", nil
+}
+
+func newTestPreparer(t *testing.T) (*Preparer, *zendesktest.Server) {
+	t.Helper()
+
+	server := zendesktest.NewServer(t)
+	server.LoadFixtures()
+
+	zd, err := zendesk.NewClient("zendesktest", zdlib.NewBearerTokenCredential(zendesktest.Token), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := zd.SetEndpointURL(server.EndpointURL()); err != nil {
+		t.Fatal(err)
+	}
+
+	return &Preparer{
+		ZD:              zd,
+		Git:             &fakeCloner{},
+		ReproRepository: "https://example.com/cs-repro.git",
+		Logf:            t.Logf,
+	}, server
+}
+
+func TestRun(t *testing.T) {
+	pr, _ := newTestPreparer(t)
+	ran := []string{}
+	pr.Hooks.After = func(_ context.Context, stage string, _ *Prep, err error) {
+		if err != nil {
+			t.Errorf("stage %s failed: %s", stage, err)
+		}
+		ran = append(ran, stage)
+	}
+
+	folder := filepath.Join(t.TempDir(), "ZD-1001")
+	// the order given does not matter
+	if err := pr.Run(context.Background(), NewPrep(zendesktest.FixtureOpenTicketID, folder), []string{StageCompose, StageTicket, StageAttachments, StageRepro, StageSupportPacket}); err != nil {
+		t.Fatalf("run failed: %s", err)
+	}
+	if strings.Join(ran, ",") != strings.Join(Stages, ",") {
+		t.Errorf("expected the stages %v, ran %v", Stages, ran)
+	}
+
+	m, err := manifest.Load(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Ticket.Subject != "Server crashes on startup" || m.Ticket.OrganizationName != "Acme Corp" {
+		t.Errorf("unexpected ticket %+v", m.Ticket)
+	}
+	if m.SupportPacket == nil || m.SupportPacket.ServerVersion != zendesktest.FixtureServerVersion {
+		t.Errorf("unexpected support packet %+v", m.SupportPacket)
+	}
+	if m.Repro == nil || m.Repro.Commit != "0123abcd" {
+		t.Errorf("unexpected repro %+v", m.Repro)
+	}
+	if !Prepared(m) {
+		t.Errorf("all the stages should be recorded, got %v", m.Stages)
+	}
+
+	compose, err := os.ReadFile(filepath.Join(folder, ReproDir, "docker-compose.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"name: cs-repro-1001",
+		"container_name: cs-repro-1001-mattermost",
+		"mattermost-enterprise-edition:" + zendesktest.FixtureServerVersion,
+	} {
+		if !strings.Contains(string(compose), expected) {
+			t.Errorf("docker-compose.yml does not contain %q:\n%s", expected, compose)
+		}
+	}
+}
+
+func TestRunStageAgain(t *testing.T) {
+	pr, server := newTestPreparer(t)
+	folder := filepath.Join(t.TempDir(), "ZD-1001")
+	if err := pr.Run(context.Background(), NewPrep(zendesktest.FixtureOpenTicketID, folder), Stages); err != nil {
+		t.Fatalf("run failed: %s", err)
+	}
+
+	// the extraction is redone from the packet downloaded before, without asking zendesk
+	if err := os.RemoveAll(filepath.Join(folder, SupportPacketDir)); err != nil {
+		t.Fatal(err)
+	}
+	requests := len(server.Requests)
+	if err := pr.Run(context.Background(), NewPrep(zendesktest.FixtureOpenTicketID, folder), []string{StageSupportPacket}); err != nil {
+		t.Fatalf("run failed: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(folder, SupportPacketDir, "support_packet.yaml")); err != nil {
+		t.Errorf("the support packet should be extracted again: %s", err)
+	}
+	if len(server.Requests) != requests {
+		t.Errorf("no request should be made, got %v", server.Requests[requests:])
+	}
+}
+
+func TestPartialRunIsNotPrepared(t *testing.T) {
+	pr, _ := newTestPreparer(t)
+	folder := filepath.Join(t.TempDir(), "ZD-1001")
+	if err := pr.Run(context.Background(), NewPrep(zendesktest.FixtureOpenTicketID, folder), []string{StageTicket}); err != nil {
+		t.Fatalf("run failed: %s", err)
+	}
+
+	m, err := manifest.Load(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Prepared(m) {
+		t.Errorf("only the ticket stage ran, got %v", m.Stages)
+	}
+
+	if err := pr.Run(context.Background(), NewPrep(zendesktest.FixtureOpenTicketID, folder), []string{StageAttachments, StageRepro, StageSupportPacket, StageCompose}); err != nil {
+		t.Fatalf("run failed: %s", err)
+	}
+	if m, err = manifest.Load(folder); err != nil {
+		t.Fatal(err)
+	}
+	if !Prepared(m) {
+		t.Errorf("the stages of both runs should be recorded, got %v", m.Stages)
+	}
+}
+
+func TestBeforeHookStops(t *testing.T) {
+	pr, _ := newTestPreparer(t)
+	stop := errors.New("stop")
+	pr.Hooks.Before = func(_ context.Context, stage string, _ *Prep) error {
+		if stage == StageRepro {
+			return stop
+		}
+		return nil
+	}
+
+	folder := filepath.Join(t.TempDir(), "ZD-1001")
+	err := pr.Run(context.Background(), NewPrep(zendesktest.FixtureOpenTicketID, folder), Stages)
+	if !errors.Is(err, stop) {
+		t.Fatalf("expected the hook error, got %v", err)
+	}
+	if pr.Git.(*fakeCloner).clones != 0 {
+		t.Error("the repro should not be cloned")
+	}
+}
+
+func TestUnknownTicketCreatesNoFolder(t *testing.T) {
+	pr, _ := newTestPreparer(t)
+
+	folder := filepath.Join(t.TempDir(), "ZD-999999")
+	if err := pr.Run(context.Background(), NewPrep(999999, folder), Stages); err == nil {
+		t.Fatal("expected an error for an unknown ticket")
+	}
+	if _, err := os.Stat(folder); err == nil {
+		t.Error("no folder should be created for an unknown ticket")
+	}
+}
+
+func TestUnzipRejectsEscapingPaths(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "mattermost_support_packet_2023-10-01-10-00.zip")
+
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	w, err := zw.Create("../escaped.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("outside"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	dest := filepath.Join(dir, "ZD-1001", SupportPacketDir)
+	if err := unzip(file, dest); err == nil {
+		t.Fatal("expected an error for a path outside of the destination")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ZD-1001", "escaped.txt")); err == nil {
+		t.Error("the entry should not be written outside of the destination")
+	}
+}
+
+func TestSelectStages(t *testing.T) {
+	tests := []struct {
+		only, skip []string
+		want       string
+		wantErr    bool
+	}{
+		{want: strings.Join(Stages, ",")},
+		{only: []string{StageCompose, StageRepro}, want: "repro,compose"},
+		{skip: []string{StageAttachments, StageSupportPacket}, want: "ticket,repro,compose"},
+		{only: []string{"download"}, wantErr: true},
+		{only: []string{StageRepro}, skip: []string{StageCompose}, wantErr: true},
+	}
+	for _, tt := range tests {
+		stages, err := SelectStages(tt.only, tt.skip)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("SelectStages(%v, %v) error = %v", tt.only, tt.skip, err)
+			continue
+		}
+		if !tt.wantErr && strings.Join(stages, ",") != tt.want {
+			t.Errorf("SelectStages(%v, %v) = %v, want %s", tt.only, tt.skip, stages, tt.want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package workspace
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// KeepDateFormat is the format of keep expiry dates
+const KeepDateFormat = "2006-01-02"
+
+// Keep is the content of a keep file. Keep files created before it existed are empty,
+// they keep the folder forever.
+type Keep struct {
+	By        string     `json:"by,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+	Until     *time.Time `json:"until,omitempty"`
+	CreatedAt time.Time  `json:"created_at,omitempty"`
+}
+
+// Expired reports whether the keep no longer protects the folder, the until day included
+func (k Keep) Expired(now time.Time) bool {
+	return k.Until != nil && !now.Before(k.Until.AddDate(0, 0, 1))
+}
+
+// ReadKeep returns the keep of a ticket folder, nil when the folder is not kept
+func ReadKeep(folder string) (*Keep, error) {
+	b, err := os.ReadFile(filepath.Join(folder, KeepFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keep file: %w", err)
+	}
+
+	k := &Keep{}
+	if len(b) == 0 {
+		return k, nil
+	}
+	if err := json.Unmarshal(b, k); err != nil {
+		return nil, fmt.Errorf("failed to decode keep file: %w", err)
+	}
+
+	return k, nil
+}
+
+// WriteKeep keeps a ticket folder, replacing any previous keep
+func WriteKeep(folder string, k Keep) error {
+	b, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode keep file: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(folder, KeepFileName), b, 0644); err != nil {
+		return fmt.Errorf("failed to write keep file: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveKeep stops keeping a ticket folder
+func RemoveKeep(folder string) error {
+	return os.Remove(filepath.Join(folder, KeepFileName))
+}
@@ -0,0 +1,101 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// locksDir holds the lock files, outside of the ticket folders so removing a folder keeps its lock
+const locksDir = ".locks"
+
+// lockPollInterval is how often a busy lock is tried again until the timeout
+const lockPollInterval = 100 * time.Millisecond
+
+// ErrBusy is returned when another command holds the lock past the timeout
+var ErrBusy = errors.New("busy")
+
+// errWouldBlock is returned by tryLock when the lock is held by someone else
+var errWouldBlock = errors.New("lock is held")
+
+// Lock is an advisory lock, held until Unlock is called or the process exits
+type Lock struct {
+	f *os.File
+}
+
+// LockTicket locks the folder of a ticket, waiting up to timeout for other commands to release it
+func (w Workspace) LockTicket(id int64, timeout time.Duration) (*Lock, error) {
+	return w.lock(FolderPrefix+strconv.FormatInt(id, 10), "ticket "+strconv.FormatInt(id, 10), timeout)
+}
+
+// LockIndex locks what is shared by all the ticket folders, like the archive index
+func (w Workspace) LockIndex(timeout time.Duration) (*Lock, error) {
+	return w.lock("index", "work dir", timeout)
+}
+
+// lock takes the lock file name, what describes the locked thing in errors
+func (w Workspace) lock(name, what string, timeout time.Duration) (*Lock, error) {
+	dir := filepath.Join(w.Dir, locksDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create locks dir: %w", err)
+	}
+
+	path := filepath.Join(dir, name+".lock")
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		err := tryLock(f)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, errWouldBlock) {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		if time.Now().After(deadline) {
+			holder := lockHolder(path)
+			f.Close()
+			return nil, fmt.Errorf("%s is %w, %s, try again later or raise lock-timeout", what, ErrBusy, holder)
+		}
+		time.Sleep(lockPollInterval)
+	}
+
+	// the pid only helps users find the other command, the lock itself is what matters
+	f.Truncate(0)
+	f.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+
+	return &Lock{f: f}, nil
+}
+
+// lockHolder describes who holds a lock from the pid it wrote
+func lockHolder(path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil || len(b) == 0 {
+		return "used by another supportctl command"
+	}
+
+	return "used by supportctl process " + strings.TrimSpace(string(b))
+}
+
+// Unlock releases the lock
+func (l *Lock) Unlock() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+
+	err := unlock(l.f)
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	l.f = nil
+
+	return err
+}
@@ -0,0 +1,14 @@
+//go:build !unix && !windows
+
+package workspace
+
+import "os"
+
+// there is no file locking on these platforms, commands are trusted not to run concurrently
+func tryLock(f *os.File) error {
+	return nil
+}
+
+func unlock(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,37 @@
+package workspace
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLockTicket(t *testing.T) {
+	ws, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := ws.LockTicket(42, 0)
+	if err != nil {
+		t.Fatalf("failed to lock: %s", err)
+	}
+
+	if _, err := ws.LockTicket(42, 0); !errors.Is(err, ErrBusy) {
+		t.Errorf("second lock should fail with ErrBusy, got %v", err)
+	}
+
+	other, err := ws.LockTicket(43, 0)
+	if err != nil {
+		t.Errorf("other tickets should not be locked: %s", err)
+	}
+	other.Unlock()
+
+	if err := lock.Unlock(); err != nil {
+		t.Fatalf("failed to unlock: %s", err)
+	}
+	again, err := ws.LockTicket(42, 0)
+	if err != nil {
+		t.Errorf("lock should be free once released: %s", err)
+	}
+	again.Unlock()
+}
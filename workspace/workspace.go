@@ -0,0 +1,111 @@
+// Package workspace finds the ticket folders of the work dir.
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// FolderPrefix starts the name of every ticket folder, followed by the ticket id
+	FolderPrefix = "ZD-"
+	// KeepFileName is the file telling prune to leave a ticket folder alone
+	KeepFileName = ".supportctl-keep"
+)
+
+// Folder is a ticket folder at the root of the work dir
+type Folder struct {
+	ID   int64
+	Path string
+}
+
+// Kept reports whether the folder has a keep file that has not expired.
+// An unreadable keep file keeps the folder, losing a folder is worse than keeping it.
+func (f Folder) Kept() bool {
+	k, err := ReadKeep(f.Path)
+	if err != nil {
+		return true
+	}
+
+	return k != nil && !k.Expired(time.Now())
+}
+
+// Malformed is an entry of the work dir that looks like a ticket folder but is not one
+type Malformed struct {
+	Path   string
+	Reason string
+}
+
+// Workspace is the work dir holding the ticket folders
+type Workspace struct {
+	Dir string
+}
+
+// New returns the workspace of the work dir, made absolute
+func New(dir string) (Workspace, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return Workspace{}, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	return Workspace{Dir: abs}, nil
+}
+
+// TicketPath returns the path of the folder of the ticket, whether it exists or not
+func (w Workspace) TicketPath(id int64) string {
+	return filepath.Join(w.Dir, FolderPrefix+strconv.FormatInt(id, 10))
+}
+
+// Scan lists the ticket folders at the root of the work dir sorted by id, without looking inside them.
+// Entries named like ticket folders that cannot be one are returned apart so callers can report them.
+func (w Workspace) Scan() ([]Folder, []Malformed, error) {
+	entries, err := os.ReadDir(w.Dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read work dir: %w", err)
+	}
+
+	folders := []Folder{}
+	malformed := []Malformed{}
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), FolderPrefix) {
+			continue
+		}
+
+		path := filepath.Join(w.Dir, e.Name())
+		id, err := ParseTicketID(strings.TrimPrefix(e.Name(), FolderPrefix))
+		if err != nil {
+			malformed = append(malformed, Malformed{Path: path, Reason: err.Error()})
+			continue
+		}
+		if !e.IsDir() {
+			malformed = append(malformed, Malformed{Path: path, Reason: "not a folder"})
+			continue
+		}
+
+		folders = append(folders, Folder{ID: id, Path: path})
+	}
+
+	sort.Slice(folders, func(i, j int) bool {
+		return folders[i].ID < folders[j].ID
+	})
+
+	return folders, malformed, nil
+}
+
+// ParseTicketID parses a ticket id as written in folder names and command arguments
+func ParseTicketID(s string) (int64, error) {
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("%q is not a ticket id", s)
+	}
+	if strconv.FormatInt(id, 10) != s {
+		return 0, fmt.Errorf("%q is not written like a ticket id", s)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,49 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScan(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"ZD-42", "ZD-7", "ZD-foo", "ZD-007", "notes", ".archive"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ZD-8"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// nested folders are never ticket folders of the work dir
+	if err := os.MkdirAll(filepath.Join(dir, "ZD-42", "cs-repro", "ZD-43"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ws, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	folders, malformed, err := ws.Scan()
+	if err != nil {
+		t.Fatalf("scan failed: %s", err)
+	}
+
+	if len(folders) != 2 || folders[0].ID != 7 || folders[1].ID != 42 {
+		t.Errorf("expected folders 7 and 42, got %+v", folders)
+	}
+	if folders[1].Path != ws.TicketPath(42) {
+		t.Errorf("expected path %s, got %s", ws.TicketPath(42), folders[1].Path)
+	}
+
+	bad := map[string]bool{}
+	for _, m := range malformed {
+		bad[filepath.Base(m.Path)] = true
+	}
+	for _, name := range []string{"ZD-foo", "ZD-007", "ZD-8"} {
+		if !bad[name] {
+			t.Errorf("%s should be reported as malformed, got %+v", name, malformed)
+		}
+	}
+}
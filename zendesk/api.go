@@ -0,0 +1,34 @@
+package zendesk
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/nukosuke/go-zendesk/zendesk"
+)
+
+// API is the subset of the zendesk API supportctl relies on
+type API interface {
+	GetTicket(ctx context.Context, ticketID int64) (zendesk.Ticket, error)
+	GetMultipleTickets(ctx context.Context, ticketIDs []int64) ([]zendesk.Ticket, error)
+	ListTicketComments(ctx context.Context, ticketID int64, opts *zendesk.ListTicketCommentsOptions) (*zendesk.ListTicketCommentsResult, error)
+	GetMergeTarget(ctx context.Context, ticketID int64) (int64, error)
+	GetTicketSLAs(ctx context.Context, ticketIDs []int64) (map[int64][]SLAPolicyMetric, error)
+	ExportTickets(ctx context.Context, cursor string, startTime time.Time) (TicketExportPage, error)
+
+	GetAllViews(ctx context.Context) ([]zendesk.View, error)
+	GetTicketsFromView(ctx context.Context, viewID int64, opts *zendesk.TicketListOptions) ([]zendesk.Ticket, zendesk.Page, error)
+	GetViewConditions(ctx context.Context, viewID int64) (ViewConditions, error)
+
+	GetOrganization(ctx context.Context, orgID int64) (zendesk.Organization, error)
+
+	GetUser(ctx context.Context, userID int64) (zendesk.User, error)
+	GetCurrentUser(ctx context.Context) (zendesk.User, error)
+	GetUserGroups(ctx context.Context, userID int64) ([]zendesk.Group, error)
+	GetTokenScopes(ctx context.Context) ([]string, error)
+
+	AttachmentClient() *http.Client
+}
+
+var _ API = (*Client)(nil)
@@ -0,0 +1,47 @@
+package zendesk
+
+import (
+	"net/http"
+
+	"github.com/nukosuke/go-zendesk/zendesk"
+)
+
+// AttachmentClient returns a http client to download attachments.
+// Requests to the zendesk instance carry the credentials so private attachments can be
+// retrieved, while the signed storage URL zendesk redirects to is requested without them.
+func (c *Client) AttachmentClient() *http.Client {
+	base := http.DefaultTransport
+	if c.httpClient.Transport != nil {
+		base = c.httpClient.Transport
+	}
+
+	// no overall timeout, support packets can be large
+	return &http.Client{
+		Transport: &credentialTransport{
+			Base: base,
+			host: c.host,
+			cred: c.cred,
+		},
+	}
+}
+
+type credentialTransport struct {
+	Base http.RoundTripper
+	host string
+	cred zendesk.Credential
+}
+
+func (t *credentialTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.cred == nil || req.URL.Host != t.host {
+		return t.Base.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	if t.cred.Bearer() {
+		req.Header.Set("Authorization", "Bearer "+t.cred.Secret())
+	} else {
+		req.SetBasicAuth(t.cred.Email(), t.cred.Secret())
+	}
+
+	return t.Base.RoundTrip(req)
+}
@@ -0,0 +1,71 @@
+package zendesk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SLA metrics the watcher warns about
+const (
+	SLAMetricFirstReply = "first_reply_time"
+	SLAMetricNextReply  = "next_reply_time"
+)
+
+// SLAStageActive is the stage of the metrics whose clock is running
+const SLAStageActive = "active"
+
+// SLAPolicyMetric is a target of the SLA policy applied to a ticket
+type SLAPolicyMetric struct {
+	Metric   string     `json:"metric"`
+	Stage    string     `json:"stage"`
+	BreachAt *time.Time `json:"breach_at"`
+	Days     int        `json:"days,omitempty"`
+	Hours    int        `json:"hours,omitempty"`
+	Minutes  int        `json:"minutes,omitempty"`
+}
+
+// TicketSLAs is the slas sideload of a ticket
+type TicketSLAs struct {
+	PolicyMetrics []SLAPolicyMetric `json:"policy_metrics"`
+}
+
+// GetTicketSLAs returns the SLA metrics of the tickets by ticket id, tickets without SLA policy are left out
+func (c *Client) GetTicketSLAs(ctx context.Context, ticketIDs []int64) (map[int64][]SLAPolicyMetric, error) {
+	metrics := map[int64][]SLAPolicyMetric{}
+	for i := 0; i < len(ticketIDs); i += 100 {
+		chunk := ticketIDs[i:min(i+100, len(ticketIDs))]
+		ids := make([]string, len(chunk))
+		for j, id := range chunk {
+			ids[j] = strconv.FormatInt(id, 10)
+		}
+
+		query := url.Values{"ids": {strings.Join(ids, ",")}, "include": {"slas"}}
+		body, err := c.Get(ctx, "/tickets/show_many.json?"+query.Encode())
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			Tickets []struct {
+				ID   int64      `json:"id"`
+				SLAs TicketSLAs `json:"slas"`
+			} `json:"tickets"`
+		}
+		if err := json.Unmarshal(body, &result); err != nil {
+			return nil, fmt.Errorf("failed to decode ticket slas: %w", err)
+		}
+
+		for _, t := range result.Tickets {
+			if len(t.SLAs.PolicyMetrics) > 0 {
+				metrics[t.ID] = t.SLAs.PolicyMetrics
+			}
+		}
+	}
+
+	return metrics, nil
+}
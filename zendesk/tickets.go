@@ -0,0 +1,60 @@
+package zendesk
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/nukosuke/go-zendesk/zendesk"
+)
+
+// MergedTag is the tag zendesk puts on tickets closed by a merge
+const MergedTag = "closed_by_merge"
+
+var mergedIntoRegex = regexp.MustCompile(`merged into (?:request|ticket) #(\d+)`)
+
+// IsNotFound reports whether zendesk answered that the resource does not exist
+func IsNotFound(err error) bool {
+	var zdErr zendesk.Error
+	if errors.As(err, &zdErr) {
+		return zdErr.Status() == http.StatusNotFound
+	}
+
+	return false
+}
+
+// IsForbidden reports whether zendesk answered that the user cannot access the resource
+func IsForbidden(err error) bool {
+	var zdErr zendesk.Error
+	if errors.As(err, &zdErr) {
+		return zdErr.Status() == http.StatusForbidden
+	}
+
+	return false
+}
+
+// GetMergeTarget returns the ticket a merged ticket was merged into, 0 if it cannot be found.
+// Zendesk does not expose it on the ticket, only in the comment it adds when merging.
+func (c *Client) GetMergeTarget(ctx context.Context, ticketID int64) (int64, error) {
+	res, err := c.ListTicketComments(ctx, ticketID, &zendesk.ListTicketCommentsOptions{
+		CursorPagination: zendesk.CursorPagination{PageSize: 10},
+		Sort:             zendesk.TicketCommentCreatedAtDesc,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, comment := range res.TicketComments {
+		body := comment.PlainBody
+		if body == "" {
+			body = comment.Body
+		}
+		if m := mergedIntoRegex.FindStringSubmatch(body); m != nil {
+			return strconv.ParseInt(m[1], 10, 64)
+		}
+	}
+
+	return 0, nil
+}
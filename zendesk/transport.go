@@ -0,0 +1,201 @@
+package zendesk
+
+import (
+	"errors"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	userAgent = "supportctl"
+
+	// timeout of a whole API call, retries included
+	requestTimeout = 2 * time.Minute
+
+	defaultMaxRetries = 4
+	minBackoff        = 500 * time.Millisecond
+	maxBackoff        = 30 * time.Second
+
+	// how long to hold requests when zendesk says there is no request left
+	// but does not tell us when the window resets
+	defaultRateLimitPause = 10 * time.Second
+)
+
+var errNotRewindable = errors.New("cannot retry a request whose body cannot be read again")
+
+// Transport is a http.RoundTripper aware of the zendesk rate limits.
+// It holds requests when the rate limit is exhausted, retries idempotent requests
+// on 429 and 5xx responses, and sets the supportctl User-Agent.
+type Transport struct {
+	Base       http.RoundTripper
+	MaxRetries int
+	Verbose    bool
+
+	mu          sync.Mutex
+	pausedUntil time.Time
+}
+
+// NewHTTPClient returns a http client using the rate limit aware transport
+func NewHTTPClient(verbose bool) *http.Client {
+	return &http.Client{
+		Timeout: requestTimeout,
+		Transport: &Transport{
+			Base:       http.DefaultTransport,
+			MaxRetries: defaultMaxRetries,
+			Verbose:    verbose,
+		},
+	}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", userAgent)
+
+	for attempt := 0; ; attempt++ {
+		if err := t.waitForRateLimit(req); err != nil {
+			return nil, err
+		}
+
+		if attempt > 0 && req.Body != nil {
+			if req.GetBody == nil {
+				return nil, errNotRewindable
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		start := time.Now()
+		resp, err := t.Base.RoundTrip(req)
+		if t.Verbose {
+			if err != nil {
+				log.Printf("%s %s failed after %s: %s", req.Method, req.URL.Redacted(), time.Since(start), err)
+			} else {
+				log.Printf("%s %s %d in %s", req.Method, req.URL.Redacted(), resp.StatusCode, time.Since(start))
+			}
+		}
+
+		if resp != nil {
+			t.trackRateLimit(resp)
+		}
+
+		if attempt >= t.MaxRetries || !isIdempotent(req.Method) || !shouldRetry(resp, err) || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		wait := backoff(attempt)
+		if resp != nil {
+			if retryAfter, ok := parseSeconds(resp.Header.Get("Retry-After")); ok {
+				wait = retryAfter
+			}
+			resp.Body.Close()
+		}
+
+		if t.Verbose {
+			log.Printf("Retrying %s %s in %s", req.Method, req.URL.Redacted(), wait)
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// waitForRateLimit blocks until the rate limit window reset if zendesk told us it is exhausted
+func (t *Transport) waitForRateLimit(req *http.Request) error {
+	t.mu.Lock()
+	wait := time.Until(t.pausedUntil)
+	t.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+
+	if t.Verbose {
+		log.Printf("Rate limit reached, waiting %s", wait.Round(time.Millisecond))
+	}
+
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
+
+// trackRateLimit pauses the next requests when zendesk says no request is left
+func (t *Transport) trackRateLimit(resp *http.Response) {
+	pause := time.Duration(0)
+
+	if remaining, err := strconv.Atoi(resp.Header.Get("X-Rate-Limit-Remaining")); err == nil && remaining <= 0 {
+		pause = defaultRateLimitPause
+		if reset, ok := parseSeconds(resp.Header.Get("Ratelimit-Reset")); ok {
+			pause = reset
+		}
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if retryAfter, ok := parseSeconds(resp.Header.Get("Retry-After")); ok {
+			pause = retryAfter
+		}
+	}
+
+	if pause <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if until := time.Now().Add(pause); until.After(t.pausedUntil) {
+		t.pausedUntil = until
+	}
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return false
+}
+
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// backoff returns an exponential delay with jitter for the given attempt
+func backoff(attempt int) time.Duration {
+	d := minBackoff << attempt
+	if d > maxBackoff || d <= 0 {
+		d = maxBackoff
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
+
+func parseSeconds(value string) (time.Duration, bool) {
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+
+	return time.Duration(seconds) * time.Second, true
+}
@@ -0,0 +1,74 @@
+package zendesk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/nukosuke/go-zendesk/zendesk"
+)
+
+// IsUnauthorized reports whether zendesk rejected the credentials used for the request
+func IsUnauthorized(err error) bool {
+	var zdErr zendesk.Error
+	if errors.As(err, &zdErr) {
+		return zdErr.Status() == http.StatusUnauthorized
+	}
+
+	return false
+}
+
+// GetCurrentUser returns the user the credentials belong to
+func (c *Client) GetCurrentUser(ctx context.Context) (zendesk.User, error) {
+	body, err := c.Get(ctx, "/users/me.json")
+	if err != nil {
+		return zendesk.User{}, err
+	}
+
+	var result struct {
+		User zendesk.User `json:"user"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return zendesk.User{}, fmt.Errorf("failed to decode user: %w", err)
+	}
+
+	return result.User, nil
+}
+
+// GetUserGroups returns the groups the user is a member of
+func (c *Client) GetUserGroups(ctx context.Context, userID int64) ([]zendesk.Group, error) {
+	body, err := c.Get(ctx, fmt.Sprintf("/users/%d/groups.json", userID))
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Groups []zendesk.Group `json:"groups"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode groups: %w", err)
+	}
+
+	return result.Groups, nil
+}
+
+// GetTokenScopes returns the scopes of the OAuth token in use
+func (c *Client) GetTokenScopes(ctx context.Context) ([]string, error) {
+	body, err := c.Get(ctx, "/oauth/tokens/current.json")
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Token struct {
+			Scopes []string `json:"scopes"`
+		} `json:"token"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode token: %w", err)
+	}
+
+	return result.Token.Scopes, nil
+}
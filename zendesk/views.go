@@ -0,0 +1,66 @@
+package zendesk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/nukosuke/go-zendesk/zendesk"
+)
+
+// ViewCondition is a condition a ticket must meet to be listed by a view.
+// Value is a string, a number or null depending on the field.
+type ViewCondition struct {
+	Field    string `json:"field"`
+	Operator string `json:"operator"`
+	Value    any    `json:"value"`
+}
+
+// ViewConditions lists the tickets meeting all the All conditions and at least one of the Any ones
+type ViewConditions struct {
+	All []ViewCondition `json:"all"`
+	Any []ViewCondition `json:"any"`
+}
+
+// GetAllViews returns all the views, going through their pages, go-zendesk only reads the first one
+func (c *Client) GetAllViews(ctx context.Context) ([]zendesk.View, error) {
+	views := []zendesk.View{}
+	for page := 1; ; page++ {
+		body, err := c.Get(ctx, fmt.Sprintf("/views.json?per_page=100&page=%d", page))
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			Views []zendesk.View `json:"views"`
+			zendesk.Page
+		}
+		if err := json.Unmarshal(body, &result); err != nil {
+			return nil, fmt.Errorf("failed to decode views: %w", err)
+		}
+		views = append(views, result.Views...)
+
+		if !result.HasNext() {
+			return views, nil
+		}
+	}
+}
+
+// GetViewConditions returns the conditions of a view, the go-zendesk View type leaves them out
+func (c *Client) GetViewConditions(ctx context.Context, viewID int64) (ViewConditions, error) {
+	body, err := c.Get(ctx, fmt.Sprintf("/views/%d.json", viewID))
+	if err != nil {
+		return ViewConditions{}, err
+	}
+
+	var result struct {
+		View struct {
+			Conditions ViewConditions `json:"conditions"`
+		} `json:"view"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return ViewConditions{}, fmt.Errorf("failed to decode view: %w", err)
+	}
+
+	return result.View.Conditions, nil
+}
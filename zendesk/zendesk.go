@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 
 	"github.com/nukosuke/go-zendesk/zendesk"
 	"github.com/spf13/viper"
@@ -15,20 +16,47 @@ import (
 var ClientID string
 var ClientSecret string
 
+const (
+	// AuthModeOAuth uses the bearer token retrieved by the login command
+	AuthModeOAuth = "oauth"
+	// AuthModeAPIToken uses an API token generated in the zendesk admin center
+	AuthModeAPIToken = "api-token"
+)
+
 type Client struct {
 	*zendesk.Client
-	subdomain string
+	subdomain  string
+	host       string
+	cred       zendesk.Credential
+	httpClient *http.Client
 }
 
 func NewClientFromViper(v *viper.Viper) (*Client, error) {
 	subdomain := v.GetString("zendesk.subdomain")
-	token := v.GetString("zendesk.bearer-token")
-	return NewClient(subdomain, token)
+
+	var cred zendesk.Credential
+	switch mode := v.GetString("zendesk.auth-mode"); mode {
+	case "", AuthModeOAuth:
+		if token := v.GetString("zendesk.bearer-token"); token != "" {
+			cred = zendesk.NewBearerTokenCredential(token)
+		}
+	case AuthModeAPIToken:
+		cred = zendesk.NewAPITokenCredential(v.GetString("zendesk.email"), v.GetString("zendesk.api-token"))
+	default:
+		return nil, fmt.Errorf("unknown auth mode %q", mode)
+	}
+
+	return NewClient(subdomain, cred, NewHTTPClient(v.GetBool("verbose")))
 }
 
-func NewClient(subdomain, token string) (*Client, error) {
-	// You can set custom *http.Client here
-	client, err := zendesk.NewClient(nil)
+// NewClient creates a client for the given subdomain, cred can be nil for unauthenticated calls
+// and httpClient nil to use the rate limit aware client.
+func NewClient(subdomain string, cred zendesk.Credential, httpClient *http.Client) (*Client, error) {
+	if httpClient == nil {
+		httpClient = NewHTTPClient(false)
+	}
+
+	client, err := zendesk.NewClient(httpClient)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create zendesk client: %w", err)
 	}
@@ -37,16 +65,30 @@ func NewClient(subdomain, token string) (*Client, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to set subdomain: %w", err)
 	}
-	if token != "" {
-		client.SetCredential(zendesk.NewBearerTokenCredential(token))
+	if cred != nil {
+		client.SetCredential(cred)
 	}
 
 	return &Client{
-		Client:    client,
-		subdomain: subdomain,
+		Client:     client,
+		subdomain:  subdomain,
+		host:       subdomain + ".zendesk.com",
+		cred:       cred,
+		httpClient: httpClient,
 	}, nil
 }
 
+// SetEndpointURL points the client to another zendesk API, e.g. a fake one in tests
+func (c *Client) SetEndpointURL(newURL string) error {
+	u, err := url.Parse(newURL)
+	if err != nil {
+		return err
+	}
+
+	c.host = u.Host
+	return c.Client.SetEndpointURL(newURL)
+}
+
 func (c *Client) GetBearerToken(ctx context.Context, email, password string) (string, error) {
 	b, err := json.Marshal(map[string]string{
 		"grant_type":    "password",
@@ -60,7 +102,7 @@ func (c *Client) GetBearerToken(ctx context.Context, email, password string) (st
 		return "", fmt.Errorf("Error marshalling body: %s", err)
 	}
 	url := "https://" + c.subdomain + ".zendesk.com/oauth/tokens"
-	resp, err := http.Post(
+	resp, err := c.httpClient.Post(
 		url,
 		"application/json",
 		bytes.NewReader(b),
@@ -0,0 +1,88 @@
+package zendesktest
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"time"
+
+	zdlib "github.com/nukosuke/go-zendesk/zendesk"
+)
+
+// IDs of the fixtures loaded by LoadFixtures
+const (
+	FixtureAgentID        int64 = 1
+	FixtureRequesterID    int64 = 2
+	FixtureOrgID          int64 = 20
+	FixtureOpenTicketID   int64 = 1001
+	FixtureSolvedOldID    int64 = 1002
+	FixtureClosedRecentID int64 = 1003
+	FixtureViewID         int64 = 500
+	FixtureViewTitle            = "Support - New & Unassigned"
+	FixtureServerVersion        = "9.1.0"
+)
+
+// SupportPacket builds a support packet zip reporting the given server version
+func SupportPacket(serverVersion string) []byte {
+	buf := &bytes.Buffer{}
+	w := zip.NewWriter(buf)
+
+	f, _ := w.Create("support_packet.yaml")
+	fmt.Fprintf(f, "server_version: %s\nserver_os: linux\n", serverVersion)
+	f, _ = w.Create("mattermost.log")
+	fmt.Fprintln(f, `{"level":"info","msg":"Server is starting"}`)
+
+	w.Close()
+	return buf.Bytes()
+}
+
+// LoadFixtures fills the server with a small but realistic data set:
+// an agent, a customer and their organization, an open ticket whose comments span several pages and carry
+// two support packets and a log file, a long solved ticket, a recently
+// closed one and a view listing the open ticket.
+func (s *Server) LoadFixtures() {
+	s.AddUser(zdlib.User{ID: FixtureAgentID, Name: "Support Agent", Email: "agent@example.com", Role: "agent"},
+		zdlib.Group{ID: 10, Name: "Support"},
+	)
+	s.AddUser(zdlib.User{ID: FixtureRequesterID, Name: "Jane Customer", Email: "jane@acme.example.com", Role: "end-user", OrganizationID: FixtureOrgID})
+	s.AddOrganization(zdlib.Organization{ID: FixtureOrgID, Name: "Acme Corp"})
+
+	s.AddTicket(zdlib.Ticket{
+		ID:             FixtureOpenTicketID,
+		Subject:        "Server crashes on startup",
+		Status:         "open",
+		RequesterID:    FixtureRequesterID,
+		OrganizationID: FixtureOrgID,
+		CreatedAt:      daysAgo(3),
+		UpdatedAt:      daysAgo(0),
+	})
+	s.AddAttachment(FixtureOpenTicketID, "mattermost_support_packet_2023-09-01-10-00.zip", SupportPacket("8.1.0"))
+	for i := 0; i < 2*s.PageSize; i++ {
+		s.AddComment(FixtureOpenTicketID, zdlib.TicketComment{Body: fmt.Sprintf("comment %d", i)})
+	}
+	s.AddAttachment(FixtureOpenTicketID, "mattermost_support_packet_2023-10-01-10-00.zip", SupportPacket(FixtureServerVersion))
+	s.AddAttachment(FixtureOpenTicketID, "mattermost.log", []byte("some logs"))
+
+	s.AddTicket(zdlib.Ticket{
+		ID:        FixtureSolvedOldID,
+		Subject:   "How do I configure SAML?",
+		Status:    "solved",
+		CreatedAt: daysAgo(120),
+		UpdatedAt: daysAgo(90),
+	})
+
+	s.AddTicket(zdlib.Ticket{
+		ID:        FixtureClosedRecentID,
+		Subject:   "License renewal",
+		Status:    "closed",
+		CreatedAt: daysAgo(10),
+		UpdatedAt: daysAgo(2),
+	})
+
+	s.AddView(zdlib.View{ID: FixtureViewID, Title: FixtureViewTitle, Active: true}, FixtureOpenTicketID)
+}
+
+func daysAgo(days int) *time.Time {
+	t := time.Now().AddDate(0, 0, -days)
+	return &t
+}
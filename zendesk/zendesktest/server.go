@@ -0,0 +1,502 @@
+// Package zendesktest provides an in-memory fake of the zendesk API for tests.
+package zendesktest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/julientant/supportctl/zendesk"
+	zdlib "github.com/nukosuke/go-zendesk/zendesk"
+)
+
+// Credentials the fake server accepts, Token is both the bearer token and the API token of Email
+const (
+	Token = "zendesktest-token"
+	Email = "agent@zendesktest.example"
+)
+
+// Server is a fake zendesk instance serving the endpoints supportctl uses.
+// Fields can be modified between requests, the server reads them under Mu.
+type Server struct {
+	*httptest.Server
+
+	Mu          sync.Mutex
+	Tickets     map[int64]zdlib.Ticket
+	Forbidden   map[int64]bool // tickets that exist but the user cannot see
+	Lagging     map[int64]bool // tickets show_many leaves out, like zendesk does while it replicates a change
+	SLAs        map[int64][]zendesk.SLAPolicyMetric
+	Comments    map[int64][]zdlib.TicketComment
+	Views       []zdlib.View
+	ViewTickets map[int64][]int64
+	// ViewConditions are served by the show view endpoint, the views only list ViewTickets
+	ViewConditions map[int64]zendesk.ViewConditions
+	Users          map[int64]zdlib.User
+	Orgs           map[int64]zdlib.Organization
+	Groups         map[int64][]zdlib.Group
+	Attachments    map[string][]byte
+	CurrentUser    int64
+	Scopes         []string
+
+	// PageSize is the number of items per page for paginated endpoints
+	PageSize int
+
+	// PrivateAttachments makes attachments require authentication. Like zendesk,
+	// authenticated requests are redirected to a signed URL on a storage server
+	// and anonymous ones get the HTML login page.
+	PrivateAttachments bool
+	storage            *httptest.Server
+
+	// FailAttachments is the number of attachment downloads to fail with a server error before serving them again
+	FailAttachments int
+
+	// Requests records the path of every request received
+	Requests []string
+
+	// changes lists the ids of the tickets in the order they were added or changed,
+	// the incremental export cursor is an offset in it
+	changes []int64
+	deleted map[int64]zdlib.Ticket
+}
+
+// NewServer starts an empty fake zendesk server, it is closed at the end of the test
+func NewServer(t interface{ Cleanup(func()) }) *Server {
+	s := &Server{
+		Tickets:        map[int64]zdlib.Ticket{},
+		Forbidden:      map[int64]bool{},
+		Lagging:        map[int64]bool{},
+		SLAs:           map[int64][]zendesk.SLAPolicyMetric{},
+		Comments:       map[int64][]zdlib.TicketComment{},
+		ViewTickets:    map[int64][]int64{},
+		ViewConditions: map[int64]zendesk.ViewConditions{},
+		deleted:        map[int64]zdlib.Ticket{},
+		Users:          map[int64]zdlib.User{},
+		Orgs:           map[int64]zdlib.Organization{},
+		Groups:         map[int64][]zdlib.Group{},
+		Attachments:    map[string][]byte{},
+		Scopes:         []string{"read"},
+		PageSize:       100,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.storage = httptest.NewServer(http.HandlerFunc(s.handleStorage))
+	t.Cleanup(s.Close)
+	t.Cleanup(s.storage.Close)
+
+	return s
+}
+
+// EndpointURL is the URL to give to the SetEndpointURL method of the zendesk clients
+func (s *Server) EndpointURL() string {
+	return s.URL + "/api/v2"
+}
+
+// AddTicket adds or replaces a ticket, the change is listed by the incremental export
+func (s *Server) AddTicket(ticket zdlib.Ticket) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	s.Tickets[ticket.ID] = ticket
+	s.changes = append(s.changes, ticket.ID)
+}
+
+// DeleteTicket deletes a ticket, the incremental export lists it with the deleted status
+func (s *Server) DeleteTicket(ticketID int64) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	ticket := s.Tickets[ticketID]
+	ticket.Status = zendesk.TicketStatusDeleted
+	s.deleted[ticketID] = ticket
+	delete(s.Tickets, ticketID)
+	s.changes = append(s.changes, ticketID)
+}
+
+// AddComment adds a comment to a ticket
+func (s *Server) AddComment(ticketID int64, comment zdlib.TicketComment) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	if comment.ID == 0 {
+		comment.ID = int64(len(s.Comments[ticketID]) + 1)
+	}
+	s.Comments[ticketID] = append(s.Comments[ticketID], comment)
+}
+
+// AddAttachment adds a comment carrying a file to a ticket, the file is served by the fake server
+func (s *Server) AddAttachment(ticketID int64, fileName string, content []byte) zdlib.Attachment {
+	s.Mu.Lock()
+	path := fmt.Sprintf("/attachments/%d/%s", ticketID, fileName)
+	s.Attachments[path] = content
+	s.Mu.Unlock()
+
+	attachment := zdlib.Attachment{
+		FileName:   fileName,
+		ContentURL: s.URL + path,
+		Size:       int64(len(content)),
+	}
+	s.AddComment(ticketID, zdlib.TicketComment{
+		Body:        "attaching " + fileName,
+		Attachments: []zdlib.Attachment{attachment},
+	})
+
+	return attachment
+}
+
+// MergeTicket closes source as merged into target, the way zendesk does
+func (s *Server) MergeTicket(source, target int64) {
+	s.Mu.Lock()
+	ticket := s.Tickets[source]
+	ticket.Status = "closed"
+	ticket.Tags = append(ticket.Tags, "closed_by_merge")
+	s.Tickets[source] = ticket
+	s.changes = append(s.changes, source)
+	s.Mu.Unlock()
+
+	s.AddComment(source, zdlib.TicketComment{
+		Body: fmt.Sprintf("This request was closed and merged into request #%d.", target),
+	})
+}
+
+// AddView adds a view listing the given tickets
+func (s *Server) AddView(view zdlib.View, ticketIDs ...int64) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	s.Views = append(s.Views, view)
+	s.ViewTickets[view.ID] = ticketIDs
+}
+
+// SetViewTickets replaces the tickets listed by a view
+func (s *Server) SetViewTickets(viewID int64, ticketIDs ...int64) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	s.ViewTickets[viewID] = ticketIDs
+}
+
+// AddUser adds a user, the first one added is the current user
+func (s *Server) AddUser(user zdlib.User, groups ...zdlib.Group) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	s.Users[user.ID] = user
+	s.Groups[user.ID] = groups
+	if s.CurrentUser == 0 {
+		s.CurrentUser = user.ID
+	}
+}
+
+// AddOrganization adds or replaces an organization
+func (s *Server) AddOrganization(org zdlib.Organization) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	s.Orgs[org.ID] = org
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	s.Requests = append(s.Requests, r.URL.Path)
+
+	authenticated := s.authenticated(r)
+
+	if content, ok := s.Attachments[r.URL.Path]; ok {
+		switch {
+		case s.FailAttachments > 0:
+			s.FailAttachments--
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		case !s.PrivateAttachments:
+			w.Header().Set("Content-Type", "application/zip")
+			w.Write(content)
+		case authenticated:
+			http.Redirect(w, r, s.storage.URL+r.URL.Path+"?signature=zendesktest", http.StatusFound)
+		default:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<html><body>Sign in to Zendesk</body></html>"))
+		}
+		return
+	}
+
+	if !authenticated {
+		writeError(w, http.StatusUnauthorized, "Couldn't authenticate you")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/v2")
+	parts := strings.Split(strings.Trim(strings.TrimSuffix(path, ".json"), "/"), "/")
+	switch {
+	case path == "/tickets/show_many.json":
+		s.showManyTickets(w, r)
+	case len(parts) == 2 && parts[0] == "tickets":
+		s.showTicket(w, parts[1])
+	case len(parts) == 3 && parts[0] == "tickets" && parts[2] == "comments":
+		s.listComments(w, r, parts[1])
+	case path == "/views.json":
+		s.listViews(w, r)
+	case len(parts) == 2 && parts[0] == "views":
+		s.showView(w, parts[1])
+	case len(parts) == 3 && parts[0] == "views" && parts[2] == "tickets":
+		s.listViewTickets(w, r, parts[1])
+	case path == "/incremental/tickets/cursor.json":
+		s.exportTickets(w, r)
+	case path == "/users/me.json":
+		s.showUser(w, strconv.FormatInt(s.CurrentUser, 10))
+	case len(parts) == 2 && parts[0] == "users":
+		s.showUser(w, parts[1])
+	case len(parts) == 3 && parts[0] == "users" && parts[2] == "groups":
+		s.listGroups(w, parts[1])
+	case len(parts) == 2 && parts[0] == "organizations":
+		s.showOrganization(w, parts[1])
+	case path == "/oauth/tokens/current.json":
+		writeJSON(w, map[string]any{"token": map[string]any{"scopes": s.Scopes}})
+	default:
+		writeError(w, http.StatusNotFound, "InvalidEndpoint")
+	}
+}
+
+// authenticated checks the bearer token, or the API token sent as basic auth with email/token as user name
+func (s *Server) authenticated(r *http.Request) bool {
+	if r.Header.Get("Authorization") == "Bearer "+Token {
+		return true
+	}
+
+	user, password, ok := r.BasicAuth()
+	return ok && user == Email+"/token" && password == Token
+}
+
+// handleStorage serves the attachments behind signed URLs, which reject any other authentication
+func (s *Server) handleStorage(w http.ResponseWriter, r *http.Request) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	s.Requests = append(s.Requests, "storage:"+r.URL.Path)
+
+	content, ok := s.Attachments[r.URL.Path]
+	if !ok || r.URL.Query().Get("signature") != "zendesktest" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Header.Get("Authorization") != "" {
+		http.Error(w, "Only one auth mechanism allowed", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Write(content)
+}
+
+func (s *Server) showTicket(w http.ResponseWriter, idStr string) {
+	id, _ := strconv.ParseInt(idStr, 10, 64)
+	if s.Forbidden[id] {
+		writeError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	ticket, ok := s.Tickets[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "RecordNotFound")
+		return
+	}
+
+	writeJSON(w, map[string]any{"ticket": ticket})
+}
+
+func (s *Server) showManyTickets(w http.ResponseWriter, r *http.Request) {
+	type ticketWithSLAs struct {
+		zdlib.Ticket
+		SLAs *zendesk.TicketSLAs `json:"slas,omitempty"`
+	}
+
+	includeSLAs := r.URL.Query().Get("include") == "slas"
+	tickets := []ticketWithSLAs{}
+	for _, idStr := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		id, _ := strconv.ParseInt(idStr, 10, 64)
+		// like zendesk, unknown and forbidden tickets are silently left out
+		ticket, ok := s.Tickets[id]
+		if !ok || s.Forbidden[id] || s.Lagging[id] {
+			continue
+		}
+
+		t := ticketWithSLAs{Ticket: ticket}
+		if includeSLAs {
+			t.SLAs = &zendesk.TicketSLAs{PolicyMetrics: s.SLAs[id]}
+		}
+		tickets = append(tickets, t)
+	}
+
+	writeJSON(w, map[string]any{"tickets": tickets})
+}
+
+func (s *Server) listComments(w http.ResponseWriter, r *http.Request, idStr string) {
+	id, _ := strconv.ParseInt(idStr, 10, 64)
+	if _, ok := s.Tickets[id]; !ok {
+		writeError(w, http.StatusNotFound, "RecordNotFound")
+		return
+	}
+
+	comments := s.Comments[id]
+	if r.URL.Query().Get("sort") == string(zdlib.TicketCommentCreatedAtDesc) {
+		reversed := make([]zdlib.TicketComment, 0, len(comments))
+		for i := len(comments) - 1; i >= 0; i-- {
+			reversed = append(reversed, comments[i])
+		}
+		comments = reversed
+	}
+
+	// the cursor is simply the offset of the next page
+	offset, _ := strconv.Atoi(r.URL.Query().Get("page[after]"))
+	end := min(offset+s.PageSize, len(comments))
+	if offset > end {
+		offset = end
+	}
+
+	meta := zdlib.CursorPaginationMeta{}
+	if end < len(comments) {
+		meta.HasMore = true
+		meta.AfterCursor = strconv.Itoa(end)
+	}
+
+	writeJSON(w, map[string]any{"comments": comments[offset:end], "meta": meta})
+}
+
+func (s *Server) listViews(w http.ResponseWriter, r *http.Request) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	start := min((page-1)*s.PageSize, len(s.Views))
+	end := min(start+s.PageSize, len(s.Views))
+
+	var nextPage *string
+	if end < len(s.Views) {
+		next := fmt.Sprintf("%s/api/v2/views.json?page=%d", s.URL, page+1)
+		nextPage = &next
+	}
+
+	writeJSON(w, map[string]any{"views": s.Views[start:end], "next_page": nextPage, "count": len(s.Views)})
+}
+
+func (s *Server) listViewTickets(w http.ResponseWriter, r *http.Request, idStr string) {
+	id, _ := strconv.ParseInt(idStr, 10, 64)
+	ids, ok := s.ViewTickets[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "RecordNotFound")
+		return
+	}
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	start := min((page-1)*s.PageSize, len(ids))
+	end := min(start+s.PageSize, len(ids))
+
+	tickets := []zdlib.Ticket{}
+	for _, ticketID := range ids[start:end] {
+		tickets = append(tickets, s.Tickets[ticketID])
+	}
+
+	var nextPage *string
+	if end < len(ids) {
+		next := fmt.Sprintf("%s/api/v2/views/%d/tickets.json?page=%d", s.URL, id, page+1)
+		nextPage = &next
+	}
+
+	writeJSON(w, map[string]any{"tickets": tickets, "next_page": nextPage, "count": len(ids)})
+}
+
+func (s *Server) showView(w http.ResponseWriter, idStr string) {
+	id, _ := strconv.ParseInt(idStr, 10, 64)
+	for _, view := range s.Views {
+		if view.ID == id {
+			writeJSON(w, map[string]any{"view": map[string]any{
+				"id":         view.ID,
+				"title":      view.Title,
+				"active":     view.Active,
+				"conditions": s.ViewConditions[id],
+			}})
+			return
+		}
+	}
+
+	writeError(w, http.StatusNotFound, "RecordNotFound")
+}
+
+// exportTickets serves the cursor based incremental export, a ticket changed several times
+// is listed once, at its last change
+func (s *Server) exportTickets(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	offset, _ := strconv.Atoi(query.Get("cursor"))
+	startTime, _ := strconv.ParseInt(query.Get("start_time"), 10, 64)
+	offset = min(offset, len(s.changes))
+	end := min(offset+s.PageSize, len(s.changes))
+
+	last := map[int64]int{}
+	for i, id := range s.changes {
+		last[id] = i
+	}
+
+	tickets := []zdlib.Ticket{}
+	for i := offset; i < end; i++ {
+		id := s.changes[i]
+		if last[id] != i && last[id] < end {
+			continue
+		}
+
+		ticket, ok := s.Tickets[id]
+		if !ok {
+			ticket = s.deleted[id]
+		}
+		if query.Has("start_time") && (ticket.UpdatedAt == nil || ticket.UpdatedAt.Unix() < startTime) {
+			continue
+		}
+		tickets = append(tickets, ticket)
+	}
+
+	writeJSON(w, map[string]any{
+		"tickets":       tickets,
+		"after_cursor":  strconv.Itoa(end),
+		"end_of_stream": end == len(s.changes),
+	})
+}
+
+func (s *Server) showUser(w http.ResponseWriter, idStr string) {
+	id, _ := strconv.ParseInt(idStr, 10, 64)
+	user, ok := s.Users[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "RecordNotFound")
+		return
+	}
+
+	writeJSON(w, map[string]any{"user": user})
+}
+
+func (s *Server) showOrganization(w http.ResponseWriter, idStr string) {
+	id, _ := strconv.ParseInt(idStr, 10, 64)
+	org, ok := s.Orgs[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "RecordNotFound")
+		return
+	}
+
+	writeJSON(w, map[string]any{"organization": org})
+}
+
+func (s *Server) listGroups(w http.ResponseWriter, idStr string) {
+	id, _ := strconv.ParseInt(idStr, 10, 64)
+	groups := append([]zdlib.Group{}, s.Groups[id]...)
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+
+	writeJSON(w, map[string]any{"groups": groups})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}